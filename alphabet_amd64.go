@@ -0,0 +1,129 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+//
+// Copyright 2005-2016, Wojciech Muła. All rights reserved.
+// Use of this source code is governed by a
+// Simplified BSD License license that can be found in
+// the LICENSE file.
+
+// +build amd64,!gccgo,!appengine,!purego
+
+package base64
+
+const invalidIndex = '\xff'
+
+// alphabet holds the lookup tables used by encodeASM and decodeASM.
+type alphabet struct {
+	encode    [64]byte
+	decodeMap [256]byte
+
+	// vector is nil if the SIMD loop of decodeASM cannot
+	// handle the alphabet.
+	vector *[80]byte
+
+	// translate is nil unless the alphabet has aliases, see alias.
+	translate *[32]byte
+}
+
+func newAlphabet(encoder string) *alphabet {
+	a := new(alphabet)
+	copy(a.encode[:], encoder)
+
+	for i := range a.decodeMap {
+		a.decodeMap[i] = invalidIndex
+	}
+
+	for i := 0; i < len(encoder); i++ {
+		a.decodeMap[encoder[i]] = byte(i)
+	}
+
+	a.vector = decodeVector(encoder)
+	return a
+}
+
+// alias makes c decode as the character as does. The SIMD loop of
+// decodeASM first translates c to as, with the from and delta tables
+// of translate selected by the high nibble, so only one alias may be
+// added for each high nibble.
+func (a *alphabet) alias(c, as byte) {
+	a.decodeMap[c] = a.decodeMap[as]
+
+	if a.translate == nil {
+		a.translate = new([32]byte)
+
+		// Each character is compared to the entry for its high
+		// nibble, so an entry with a different high nibble never
+		// matches.
+		for i := range a.translate[:16] {
+			a.translate[i] = byte(i+1) << 4
+		}
+	}
+
+	from, delta := a.translate[:16], a.translate[16:]
+
+	n := c >> 4
+	if from[n]>>4 == n {
+		panic("alphabet already has an alias with the same high nibble")
+	}
+
+	from[n], delta[n] = c, as-c
+}
+
+// decodeVector returns the lower bound, upper bound, shift, special
+// character and special shift tables used by the SIMD loop of decodeASM,
+// or nil if the alphabet cannot be vectorised.
+//
+// The high nibble of each character selects a lower bound, upper bound and
+// shift. Every character in the alphabet that shares a high nibble must
+// belong to one run of consecutive characters with consecutive values,
+// except for a single special character that is matched separately, as '/'
+// is for the standard alphabet and '_' is for the URL alphabet.
+func decodeVector(encoder string) *[80]byte {
+	const linv, hinv = 1, 0
+
+	var vector [80]byte
+	lower, upper, shifts := vector[0:16], vector[16:32], vector[32:48]
+	special, specialShift := vector[48:64], vector[64:80]
+
+	for i := range lower {
+		lower[i], upper[i] = linv, hinv
+	}
+
+	var seen [16]bool
+	var hasSpecial bool
+
+	// Without a special character, the first character is matched
+	// by both the bounds and the special character check.
+	special[0] = encoder[0]
+
+	for i := 0; i < len(encoder); i++ {
+		c := encoder[i]
+		n := c >> 4
+
+		switch {
+		case c >= 0x80:
+			// The bounds are compared as signed bytes.
+			return nil
+		case !seen[n]:
+			seen[n] = true
+			lower[n], upper[n] = c, c
+			shifts[n] = byte(i) - c
+		case c == upper[n]+1 && byte(i)-c == shifts[n]:
+			upper[n] = c
+		case !hasSpecial:
+			hasSpecial = true
+			special[0] = c
+			specialShift[0] = byte(i) - c - shifts[n]
+		default:
+			return nil
+		}
+	}
+
+	for i := 1; i < 16; i++ {
+		special[i], specialShift[i] = special[0], specialShift[0]
+	}
+
+	return &vector
+}
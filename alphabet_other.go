@@ -0,0 +1,65 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+// +build !amd64 gccgo appengine purego
+
+package base64
+
+const invalidIndex = '\xff'
+
+// invalidShift is the value of decodeShift for characters that are
+// not in the alphabet. Any valid quantum fits in 24 bits.
+const invalidShift = 0xffffffff
+
+// alphabet holds the lookup tables used by Encode and decode.
+type alphabet struct {
+	encode    [64]byte
+	decodeMap [256]byte
+
+	// encodePair maps 12 bits of input to the two characters
+	// that encode them.
+	encodePair [4096]uint16
+
+	// decodeShift maps each character to its value shifted into
+	// place for each of the four positions of a quantum, or to
+	// invalidShift.
+	decodeShift [4][256]uint32
+}
+
+// alias makes c decode as the character as does.
+func (a *alphabet) alias(c, as byte) {
+	a.decodeMap[c] = a.decodeMap[as]
+
+	for j := range a.decodeShift {
+		a.decodeShift[j][c] = a.decodeShift[j][as]
+	}
+}
+
+func newAlphabet(encoder string) *alphabet {
+	a := new(alphabet)
+	copy(a.encode[:], encoder)
+
+	for i := range a.decodeMap {
+		a.decodeMap[i] = invalidIndex
+
+		for j := range a.decodeShift {
+			a.decodeShift[j][i] = invalidShift
+		}
+	}
+
+	for i := 0; i < len(encoder); i++ {
+		a.decodeMap[encoder[i]] = byte(i)
+
+		for j := range a.decodeShift {
+			a.decodeShift[j][encoder[i]] = uint32(i) << uint(18-6*j)
+		}
+	}
+
+	for i := range a.encodePair {
+		a.encodePair[i] = uint16(encoder[i>>6])<<8 | uint16(encoder[i&0x3f])
+	}
+
+	return a
+}
@@ -0,0 +1,329 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+// Package armor implements OpenPGP ASCII armor, as described in RFC 4880
+// section 6, using go-base64.
+//
+// The CRC-24 checksum is computed over each chunk of data as it is passed
+// to the encoder or returned from the decoder, so the data is only read
+// once.
+package armor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/tmthrgd/go-base64"
+)
+
+// A Block is an armored block read by Decode.
+type Block struct {
+	Type   string            // The type, taken from the armor header line (i.e. "PGP MESSAGE").
+	Header map[string]string // Optional headers.
+	Body   io.Reader         // A Reader from which the decoded contents can be read.
+}
+
+var (
+	// ErrCorrupt is returned when the armor is not correctly formed.
+	ErrCorrupt = errors.New("armor: invalid armor")
+
+	// ErrChecksum is returned by the Body of a Block once it has been
+	// read if its contents do not match the armor checksum.
+	ErrChecksum = errors.New("armor: checksum mismatch")
+)
+
+const lineLength = 64
+
+var (
+	// bodyEncoding also skips any trailing whitespace on each line.
+	bodyEncoding = base64.StdEncoding.WithIgnore(" \t\r\n")
+
+	encodeEncoding = base64.StdEncoding.WithLineWrap(lineLength, "\n")
+)
+
+const (
+	armorStart     = "-----BEGIN "
+	armorEnd       = "-----END "
+	armorEndOfLine = "-----"
+)
+
+// armorLine returns the type of line if it is an armor header or tail line
+// beginning with prefix.
+func armorLine(line []byte, prefix string) (typ string, ok bool) {
+	if !bytes.HasPrefix(line, []byte(prefix)) || !bytes.HasSuffix(line, []byte(armorEndOfLine)) ||
+		len(line) < len(prefix)+len(armorEndOfLine) {
+		return "", false
+	}
+
+	return string(line[len(prefix) : len(line)-len(armorEndOfLine)]), true
+}
+
+// readLine returns the next line from r without trailing whitespace. The
+// line is only valid until the next read from r.
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	switch {
+	case err == bufio.ErrBufferFull:
+		return nil, ErrCorrupt
+	case err == io.EOF && len(line) != 0:
+		err = nil
+	}
+
+	return bytes.TrimRight(line, " \t\r\n"), err
+}
+
+// Decode reads the first armored block from in, skipping any text before
+// it. It returns io.EOF if in contains no armored block. The contents are
+// decoded as Body is read, which returns ErrChecksum at the end of the
+// block if they do not match the checksum. A missing checksum is not an
+// error.
+func Decode(in io.Reader) (*Block, error) {
+	r := bufio.NewReader(in)
+
+	var typ string
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+
+		var ok bool
+		if typ, ok = armorLine(line, armorStart); ok {
+			break
+		}
+	}
+
+	header := make(map[string]string)
+	for {
+		line, err := readLine(r)
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		} else if err != nil {
+			return nil, err
+		}
+
+		if len(line) == 0 {
+			break
+		}
+
+		i := bytes.IndexByte(line, ':')
+		if i < 0 {
+			return nil, ErrCorrupt
+		}
+
+		header[string(bytes.TrimSpace(line[:i]))] = string(bytes.TrimSpace(line[i+1:]))
+	}
+
+	lr := &lineReader{r: r, typ: typ}
+	return &Block{
+		Type:   typ,
+		Header: header,
+		Body: &bodyReader{
+			lr:  lr,
+			b64: base64.NewDecoder(bodyEncoding, lr),
+			crc: crc24Init,
+		},
+	}, nil
+}
+
+// lineReader returns the base64 lines of the body of an armored block,
+// and reads the checksum and armor tail that follow them.
+type lineReader struct {
+	r   *bufio.Reader
+	typ string
+
+	line []byte // unread part of the current line
+	mid  bool   // whether line was read part way through a line
+	eof  bool
+
+	crc     uint32
+	haveCRC bool
+}
+
+// Read copies as many lines into p as it can without blocking once it has
+// copied one, so that the decoder is not limited to a line at a time.
+func (l *lineReader) Read(p []byte) (n int, err error) {
+	for n < len(p) {
+		if len(l.line) == 0 {
+			if l.eof || n != 0 && !l.buffered() {
+				break
+			}
+
+			if err := l.next(); err != nil {
+				return n, err
+			}
+
+			continue
+		}
+
+		nn := copy(p[n:], l.line)
+		l.line = l.line[nn:]
+		n += nn
+	}
+
+	if n == 0 && l.eof {
+		return 0, io.EOF
+	}
+
+	return n, nil
+}
+
+// buffered reports whether a whole line can be read without blocking.
+func (l *lineReader) buffered() bool {
+	buf, _ := l.r.Peek(l.r.Buffered())
+	return bytes.IndexByte(buf, '\n') >= 0
+}
+
+// next reads the next line of the body into line, or reads the checksum
+// and armor tail.
+func (l *lineReader) next() error {
+	line, err := l.r.ReadSlice('\n')
+	switch {
+	case err == io.EOF && len(line) == 0:
+		return io.ErrUnexpectedEOF
+	case err != nil && err != io.EOF && err != bufio.ErrBufferFull:
+		return err
+	}
+
+	// Only the start of a line may begin the checksum or tail.
+	mid := l.mid
+	l.mid = err == bufio.ErrBufferFull
+
+	if !mid && len(line) != 0 && (line[0] == '=' || line[0] == '-') {
+		return l.readTail(bytes.TrimRight(line, " \t\r\n"))
+	}
+
+	l.line = line
+	return nil
+}
+
+// readTail reads the checksum line, if there is one, and the armor tail
+// line that follows the body.
+func (l *lineReader) readTail(line []byte) error {
+	if line[0] == '=' {
+		var crc [3]byte
+		if n, err := base64.StdEncoding.Decode(crc[:], line[1:]); err != nil || n != len(crc) || len(line) != 5 {
+			return ErrCorrupt
+		}
+
+		l.crc = uint32(crc[0])<<16 | uint32(crc[1])<<8 | uint32(crc[2])
+		l.haveCRC = true
+
+		var err error
+		if line, err = readLine(l.r); err == io.EOF {
+			return io.ErrUnexpectedEOF
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if typ, ok := armorLine(line, armorEnd); !ok || typ != l.typ {
+		return ErrCorrupt
+	}
+
+	l.eof = true
+	return nil
+}
+
+// bodyReader decodes the body of an armored block and checks its
+// checksum once it has all been read.
+type bodyReader struct {
+	lr  *lineReader
+	b64 io.Reader
+	crc uint32
+}
+
+func (r *bodyReader) Read(p []byte) (n int, err error) {
+	n, err = r.b64.Read(p)
+	r.crc = crc24(r.crc, p[:n])
+
+	if err == io.EOF && r.lr.haveCRC && r.crc != r.lr.crc {
+		err = ErrChecksum
+	}
+
+	return
+}
+
+// Encode returns a WriteCloser which armors the data written to it in a
+// block of blockType with the given headers. The armor header line and
+// headers are written to out immediately, and the checksum and armor tail
+// line are written by Close.
+func Encode(out io.Writer, blockType string, headers map[string]string) (w io.WriteCloser, err error) {
+	keys := make([]string, 0, len(headers))
+	for k, v := range headers {
+		if strings.ContainsAny(k, ":\r\n") || strings.ContainsAny(v, "\r\n") {
+			return nil, errors.New("armor: invalid header")
+		}
+
+		keys = append(keys, k)
+	}
+
+	// For consistency of output, write headers sorted by key.
+	sort.Strings(keys)
+
+	buf := append([]byte(armorStart), blockType...)
+	buf = append(buf, armorEndOfLine+"\n"...)
+
+	for _, k := range keys {
+		buf = append(buf, k...)
+		buf = append(buf, ": "...)
+		buf = append(buf, headers[k]...)
+		buf = append(buf, '\n')
+	}
+
+	buf = append(buf, '\n')
+
+	if _, err := out.Write(buf); err != nil {
+		return nil, err
+	}
+
+	return &encoder{
+		out: out,
+		b64: base64.NewEncoder(encodeEncoding, out),
+		typ: blockType,
+		crc: crc24Init,
+	}, nil
+}
+
+type encoder struct {
+	out io.Writer
+	b64 io.WriteCloser
+	typ string
+
+	crc  uint32
+	body bool // whether any data has been written
+}
+
+func (e *encoder) Write(p []byte) (n int, err error) {
+	e.crc = crc24(e.crc, p)
+	e.body = e.body || len(p) != 0
+	return e.b64.Write(p)
+}
+
+func (e *encoder) Close() error {
+	if err := e.b64.Close(); err != nil {
+		return err
+	}
+
+	var buf []byte
+	if e.body {
+		// encodeEncoding does not write a newline after the last line.
+		buf = append(buf, '\n')
+	}
+
+	crc := [3]byte{byte(e.crc >> 16), byte(e.crc >> 8), byte(e.crc)}
+	buf = append(buf, '=')
+	buf = base64.StdEncoding.AppendEncode(buf, crc[:])
+	buf = append(buf, "\n"+armorEnd...)
+	buf = append(buf, e.typ...)
+	buf = append(buf, armorEndOfLine+"\n"...)
+
+	_, err := e.out.Write(buf)
+	return err
+}
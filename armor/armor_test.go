@@ -0,0 +1,209 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package armor
+
+import (
+	"bytes"
+	ref "encoding/base64"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tmthrgd/go-base64"
+)
+
+// refCRC24 is the bit at a time CRC-24 from RFC 4880 section 6.1.
+func refCRC24(p []byte) uint32 {
+	crc := uint32(crc24Init)
+	for _, c := range p {
+		crc ^= uint32(c) << 16
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= crc24Poly
+			}
+		}
+	}
+
+	return crc & 0xffffff
+}
+
+func TestCRC24(t *testing.T) {
+	if crc := crc24(crc24Init, []byte("123456789")); crc != 0x21cf02 {
+		t.Errorf("crc24(%q) = %#06x, expected %#06x", "123456789", crc, 0x21cf02)
+	}
+
+	for l := 0; l < 256; l++ {
+		data := make([]byte, l)
+		rand.Read(data)
+
+		expect := refCRC24(data)
+		if crc := crc24(crc24Init, data); crc != expect {
+			t.Fatalf("crc24(%x) = %#06x, expected %#06x", data, crc, expect)
+		}
+
+		if i := rand.Intn(l + 1); crc24(crc24(crc24Init, data[:i]), data[i:]) != expect {
+			t.Fatalf("crc24(%x) split at %d did not match", data, i)
+		}
+	}
+}
+
+// armored returns the armor of data built with encoding/base64 and
+// refCRC24, with lines separated by sep.
+func armored(typ string, data []byte, sep string) string {
+	crc := refCRC24(data)
+	body := ref.StdEncoding.EncodeToString(data)
+
+	var buf bytes.Buffer
+	buf.WriteString("-----BEGIN " + typ + "-----" + sep)
+	buf.WriteString("Comment: test" + sep + sep)
+
+	for ; len(body) > lineLength; body = body[lineLength:] {
+		buf.WriteString(body[:lineLength] + sep)
+	}
+
+	if body != "" {
+		buf.WriteString(body + sep)
+	}
+
+	buf.WriteString("=" + ref.StdEncoding.EncodeToString([]byte{byte(crc >> 16), byte(crc >> 8), byte(crc)}) + sep)
+	buf.WriteString("-----END " + typ + "-----" + sep)
+	return buf.String()
+}
+
+func TestEncode(t *testing.T) {
+	for l := 0; l < 300; l++ {
+		data := make([]byte, l)
+		rand.Read(data)
+
+		var buf bytes.Buffer
+		w, err := Encode(&buf, "PGP MESSAGE", map[string]string{"Comment": "test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for p := data; len(p) > 0; {
+			n := rand.Intn(len(p) + 1)
+			if _, err := w.Write(p[:n]); err != nil {
+				t.Fatal(err)
+			}
+
+			p = p[n:]
+		}
+
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if expect := armored("PGP MESSAGE", data, "\n"); buf.String() != expect {
+			t.Fatalf("Encode(%x) = %q, expected %q", data, buf.String(), expect)
+		}
+	}
+}
+
+func TestEncodeBadHeader(t *testing.T) {
+	for _, header := range []map[string]string{
+		{"A:B": "C"},
+		{"A\n": "B"},
+		{"A": "B\nC"},
+	} {
+		if _, err := Encode(ioutil.Discard, "PGP MESSAGE", header); err == nil {
+			t.Errorf("Encode with header %q did not fail", header)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	for _, sep := range []string{"\n", "\r\n", " \t\n"} {
+		for l := 0; l < 300; l++ {
+			data := make([]byte, l)
+			rand.Read(data)
+
+			src := "junk\n" + armored("PGP SIGNATURE", data, sep) + "trailer"
+
+			b, err := Decode(strings.NewReader(src))
+			if err != nil {
+				t.Fatalf("Decode(%q) returned %v", src, err)
+			}
+
+			if b.Type != "PGP SIGNATURE" || !reflect.DeepEqual(b.Header, map[string]string{"Comment": "test"}) {
+				t.Fatalf("Decode(%q) returned type %q and headers %q", src, b.Type, b.Header)
+			}
+
+			got, err := ioutil.ReadAll(b.Body)
+			if err != nil {
+				t.Fatalf("Decode(%q) body returned %v", src, err)
+			}
+
+			if !bytes.Equal(got, data) {
+				t.Fatalf("Decode(%q) = %x, expected %x", src, got, data)
+			}
+		}
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	src := armored("PGP MESSAGE", []byte("hello, world"), "\n")
+	crcLine := src[strings.Index(src, "\n=")+1:]
+	crcLine = crcLine[:strings.IndexByte(crcLine, '\n')+1]
+
+	for _, test := range []struct {
+		src    string
+		expect error
+	}{
+		{strings.Replace(src, crcLine, "", 1), nil},
+		{strings.Replace(src, crcLine, "=AAAA\n", 1), ErrChecksum},
+		{strings.Replace(src, crcLine, "=AAA\n", 1), ErrCorrupt},
+		{strings.Replace(src, "aGVs", "aGVt", 1), ErrChecksum},
+		{strings.Replace(src, "aGVs", "aG*s", 1), base64.CorruptInputError{Offset: 2, Char: '*', Reason: base64.InvalidCharacter}},
+		{strings.Replace(src, "END PGP MESSAGE", "END PGP SIGNATURE", 1), ErrCorrupt},
+		{src[:strings.Index(src, "-----END")], io.ErrUnexpectedEOF},
+	} {
+		b, err := Decode(strings.NewReader(test.src))
+		if err != nil {
+			t.Fatalf("Decode(%q) returned %v", test.src, err)
+		}
+
+		if _, err := ioutil.ReadAll(b.Body); err != test.expect {
+			t.Errorf("Decode(%q) body returned %v, expected %v", test.src, err, test.expect)
+		}
+	}
+
+	for _, src := range []string{"", "no armor\n", "-----BEGIN PGP MESSAGE-----\n"} {
+		if _, err := Decode(strings.NewReader(src)); err == nil {
+			t.Errorf("Decode(%q) did not fail", src)
+		}
+	}
+
+	if _, err := Decode(strings.NewReader("-----BEGIN PGP MESSAGE-----\nnot a header\n\n")); err != ErrCorrupt {
+		t.Errorf("Decode with an invalid header returned %v, expected %v", err, ErrCorrupt)
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	data := make([]byte, 1024*1024)
+	b.SetBytes(int64(len(data)))
+
+	for i := 0; i < b.N; i++ {
+		w, _ := Encode(ioutil.Discard, "PGP MESSAGE", nil)
+		w.Write(data)
+		w.Close()
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	data := make([]byte, 1024*1024)
+	src := armored("PGP MESSAGE", data, "\n")
+	b.SetBytes(int64(len(data)))
+
+	for i := 0; i < b.N; i++ {
+		blk, _ := Decode(strings.NewReader(src))
+		io.Copy(ioutil.Discard, blk.Body)
+	}
+}
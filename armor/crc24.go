@@ -0,0 +1,63 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package armor
+
+import "encoding/binary"
+
+// The CRC-24 of RFC 4880 section 6.1.
+const (
+	crc24Init = 0xb704ce
+	crc24Poly = 0x1864cfb
+)
+
+// crc24Table holds the slicing-by-8 tables for CRC-24. The CRC is kept in
+// the top 24 bits of a uint32 so that whole words of input can be XORed
+// into it, and crc24Table[k][b] is the CRC of b followed by k zero bytes.
+var crc24Table [8][256]uint32
+
+func init() {
+	for i := range crc24Table[0] {
+		crc := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ crc24Poly<<8&0xffffffff
+			} else {
+				crc <<= 1
+			}
+		}
+
+		crc24Table[0][i] = crc
+	}
+
+	for i := range crc24Table[0] {
+		crc := crc24Table[0][i]
+		for k := 1; k < len(crc24Table); k++ {
+			crc = crc<<8 ^ crc24Table[0][crc>>24]
+			crc24Table[k][i] = crc
+		}
+	}
+}
+
+// crc24 returns crc, which must be a value returned by crc24 or
+// crc24Init, updated with p.
+func crc24(crc uint32, p []byte) uint32 {
+	t := &crc24Table
+	crc <<= 8
+
+	for ; len(p) >= 8; p = p[8:] {
+		a := crc ^ binary.BigEndian.Uint32(p)
+		b := binary.BigEndian.Uint32(p[4:])
+
+		crc = t[7][a>>24] ^ t[6][a>>16&0xff] ^ t[5][a>>8&0xff] ^ t[4][a&0xff] ^
+			t[3][b>>24] ^ t[2][b>>16&0xff] ^ t[1][b>>8&0xff] ^ t[0][b&0xff]
+	}
+
+	for _, c := range p {
+		crc = crc<<8 ^ t[0][crc>>24^uint32(c)]
+	}
+
+	return crc >> 8
+}
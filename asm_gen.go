@@ -30,7 +30,7 @@ const encodeHeader = `// Copyright 2016 Tom Thorogood. All rights reserved.
 //
 // This file is auto-generated - do not modify
 
-// +build amd64,!gccgo,!appengine
+// +build amd64,!gccgo,!appengine,!purego
 `
 
 const decodeHeader = `// Copyright 2016 Tom Thorogood. All rights reserved.
@@ -40,9 +40,32 @@ const decodeHeader = `// Copyright 2016 Tom Thorogood. All rights reserved.
 //
 // This file is auto-generated - do not modify
 
-// +build amd64,!gccgo,!appengine
+// +build amd64,!gccgo,!appengine,!purego
 `
 
+const cpuHeader = `// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+//
+// This file is auto-generated - do not modify
+
+// +build amd64,!gccgo,!appengine,!purego
+`
+
+// These must match the loop constants in cpu_amd64.go.
+const (
+	loopScalar = iota
+	loopSSE
+	loopAVX
+	loopAVX2
+)
+
+var (
+	encodeLoop = asm.Data("·encodeLoop")
+	decodeLoop = asm.Data("·decodeLoop")
+)
+
 func repeat(b byte, l int) []byte {
 	return bytes.Repeat([]byte{b}, l)
 }
@@ -54,9 +77,9 @@ type encode struct {
 
 	ret, tail asm.Label
 
-	compare25, compare51, compare62, compare63 asm.Operand
+	lookup [4]asm.Operand
 
-	baseUpper, baseLower, baseZero, base62, base63 asm.Operand
+	saturate, step asm.Operand
 
 	shuf, shufOut, and asm.Data
 }
@@ -77,12 +100,12 @@ func (e *encode) vpand_sse(ops ...asm.Operand) {
 	e.Pand(ops[0], ops[2])
 }
 
-func (e *encode) vpcmpgtb_sse(ops ...asm.Operand) {
+func (e *encode) vpaddusb_sse(ops ...asm.Operand) {
 	if len(ops) != 3 {
 		panic("wrong number of operands")
 	}
 
-	if ops[1] == ops[2] {
+	if ops[0] == ops[2] {
 		panic("invalid register choice fallback")
 	}
 
@@ -90,43 +113,23 @@ func (e *encode) vpcmpgtb_sse(ops ...asm.Operand) {
 		e.Movou(ops[0], ops[1])
 	}
 
-	e.Pcmpgtb(ops[0], ops[2])
+	e.Paddusb(ops[0], ops[2])
 }
 
-func (e *encode) vpcmpeqb_sse(ops ...asm.Operand) {
+func (e *encode) vpshufb_sse(ops ...asm.Operand) {
 	if len(ops) != 3 {
 		panic("wrong number of operands")
 	}
 
-	if ops[1] == ops[2] {
-		panic("invalid register choice fallback")
-	}
-
-	if ops[0] != ops[1] {
-		e.Movou(ops[0], ops[1])
-	}
-
-	e.Pcmpeqb(ops[0], ops[1])
-}
-
-func (e *encode) vpblendvb_sse(ops ...asm.Operand) {
-	if len(ops) != 4 {
-		panic("wrong number of operands")
-	}
-
-	if ops[0] == asm.X0 || ops[0] == ops[2] {
+	if ops[0] == ops[2] {
 		panic("invalid register choice fallback")
 	}
 
-	if ops[3] != asm.X0 {
-		e.Movou(asm.X0, ops[3])
-	}
-
 	if ops[0] != ops[1] {
 		e.Movou(ops[0], ops[1])
 	}
 
-	e.Pblendvb(ops[0], ops[2], asm.X0)
+	e.Pshufb(ops[0], ops[2])
 }
 
 func (e *encode) Unpack(vpand func(ops ...asm.Operand)) {
@@ -149,32 +152,41 @@ func (e *encode) Unpack(vpand func(ops ...asm.Operand)) {
 	e.Pshufb(asm.X1, e.shufOut)
 }
 
-func (e *encode) Lookup(vpcmpgtb, vpcmpeqb, vpblendvb func(ops ...asm.Operand)) {
-	vpcmpgtb(asm.X2, asm.X1, e.compare25)
-	vpcmpgtb(asm.X3, asm.X1, e.compare51)
-	vpcmpeqb(asm.X4, asm.X1, e.compare62)
-	vpcmpeqb(asm.X5, asm.X1, e.compare63)
-
-	vpblendvb(asm.X2, e.baseUpper, e.baseLower, asm.X2)
-	vpblendvb(asm.X2, asm.X2, e.baseZero, asm.X3)
-
-	e.Paddb(asm.X1, asm.X2)
-
-	vpblendvb(asm.X1, asm.X1, e.base62, asm.X4)
-	vpblendvb(asm.X1, asm.X1, e.base63, asm.X5)
+// Lookup maps each 6-bit value in X1 to its character in the alphabet.
+//
+// The alphabet is split into four 16 byte tables for pshufb. For table i,
+// 16*i is subtracted from each value and 0x70 is added with unsigned
+// saturation. Only values that belong to table i end up in the range
+// 0x70-0x7f, all others have the high bit set and pshufb zeroes them.
+func (e *encode) Lookup(vpaddusb, vpshufb func(ops ...asm.Operand)) {
+	vpaddusb(asm.X2, asm.X1, e.saturate)
+	vpshufb(asm.X0, e.lookup[0], asm.X2)
+
+	for i, lookup := range e.lookup[1:] {
+		e.Psubb(asm.X1, e.step)
+		vpaddusb(asm.X2, asm.X1, e.saturate)
+
+		if i == len(e.lookup)-2 {
+			vpshufb(asm.X1, lookup, asm.X2)
+			e.Por(asm.X1, asm.X0)
+		} else {
+			vpshufb(asm.X3, lookup, asm.X2)
+			e.Por(asm.X0, asm.X3)
+		}
+	}
 }
 
-func (e *encode) Convert(vpand, vpcmpgtb, vpcmpeqb, vpblendvb func(ops ...asm.Operand)) {
+func (e *encode) Convert(vpand, vpaddusb, vpshufb func(ops ...asm.Operand)) {
 	e.Unpack(vpand)
-	e.Lookup(vpcmpgtb, vpcmpeqb, vpblendvb)
+	e.Lookup(vpaddusb, vpshufb)
 }
 
-func (e *encode) BigLoop(l asm.Label, vpand, vpcmpgtb, vpcmpeqb, vpblendvb func(ops ...asm.Operand)) {
+func (e *encode) BigLoop(l asm.Label, vpand, vpaddusb, vpshufb func(ops ...asm.Operand)) {
 	e.Label(l)
 
 	e.Movou(asm.X1, asm.Address(e.si))
 
-	e.Convert(vpand, vpcmpgtb, vpcmpeqb, vpblendvb)
+	e.Convert(vpand, vpaddusb, vpshufb)
 
 	e.Movou(asm.Address(e.di), asm.X1)
 
@@ -191,6 +203,84 @@ func (e *encode) BigLoop(l asm.Label, vpand, vpcmpgtb, vpcmpeqb, vpblendvb func(
 	e.Jb(e.tail)
 }
 
+// encodeAVX2 holds the ymm registers used by the AVX2 loop of encodeASM.
+// All of the constants are kept in registers as the VEX-encoded AVX2
+// instructions cannot address the data section.
+type encodeAVX2 struct {
+	*encode
+
+	shuf, shufOut asm.Operand
+
+	and, lookup [4]asm.Operand
+
+	saturate, step asm.Operand
+}
+
+// Unpack is encode.Unpack for Y1. Each 128-bit lane of Y1 holds 12 bytes
+// of input, so the shuffles behave exactly as they do for X1.
+func (e *encodeAVX2) Unpack() {
+	e.Vpshufb(asm.Y1, asm.Y1, e.shuf)
+
+	e.Vpand(asm.Y0, asm.Y1, e.and[0])
+
+	e.Vpslld(asm.Y1, asm.Y1, asm.Constant(4))
+	e.Vpand(asm.Y1, asm.Y1, e.and[1])
+
+	e.Vpor(asm.Y1, asm.Y1, asm.Y0)
+
+	e.Vpand(asm.Y0, asm.Y1, e.and[2])
+
+	e.Vpslld(asm.Y1, asm.Y1, asm.Constant(2))
+	e.Vpand(asm.Y1, asm.Y1, e.and[3])
+
+	e.Vpor(asm.Y1, asm.Y1, asm.Y0)
+
+	e.Vpshufb(asm.Y1, asm.Y1, e.shufOut)
+}
+
+// Lookup is encode.Lookup for Y1.
+func (e *encodeAVX2) Lookup() {
+	e.Vpaddusb(asm.Y2, asm.Y1, e.saturate)
+	e.Vpshufb(asm.Y0, e.lookup[0], asm.Y2)
+
+	for i, lookup := range e.lookup[1:] {
+		e.Vpsubb(asm.Y1, asm.Y1, e.step)
+		e.Vpaddusb(asm.Y2, asm.Y1, e.saturate)
+
+		if i == len(e.lookup)-2 {
+			e.Vpshufb(asm.Y1, lookup, asm.Y2)
+			e.Vpor(asm.Y1, asm.Y1, asm.Y0)
+		} else {
+			e.Vpshufb(asm.Y3, lookup, asm.Y2)
+			e.Vpor(asm.Y0, asm.Y0, asm.Y3)
+		}
+	}
+}
+
+// BigLoop encodes 24 bytes into 32 characters per iteration. The high
+// lane is loaded from 12 bytes past the low lane, so 28 bytes must remain,
+// and at least 4 bytes are left for the 128-bit loops once it is done.
+func (e *encodeAVX2) BigLoop(l asm.Label) {
+	e.Label(l)
+
+	e.Vmovdqu(asm.X1, asm.Address(e.si))
+	e.Vinserti128(asm.Y1, asm.Y1, asm.Address(e.si, 12), asm.Constant(1))
+
+	e.Unpack()
+	e.Lookup()
+
+	e.Vmovdqu(asm.Address(e.di), asm.Y1)
+
+	e.Addq(e.si, asm.Constant(24))
+	e.Addq(e.di, asm.Constant(32))
+	e.Subq(e.cx, asm.Constant(24))
+
+	e.Cmpq(asm.Constant(24+4), e.cx)
+	e.Jae(l)
+
+	e.Vzeroupper()
+}
+
 func encodeASM(a *asm.Asm) {
 	shuf := a.Data32("encodeShuf", []uint32{
 		0xff000102,
@@ -214,25 +304,10 @@ func encodeASM(a *asm.Asm) {
 		0x3f003f003f003f00,
 		0x3f003f003f003f00,
 	})
-	compare := a.Data("encodeCompare", bytes.Join([][]byte{
-		repeat(25, 16),
-		repeat(51, 16),
-		repeat(62, 16),
-		repeat(63, 16),
-	}, nil))
-	var c52 byte = 52
-	base := a.Data("encodeBase", bytes.Join([][]byte{
-		repeat('A', 16),
-		repeat('a'-26, 16),
-		repeat('0'-c52, 16),
-		repeat('+', 16),
-		repeat('/', 16),
-		repeat('-', 16),
-		repeat('_', 16),
+	lookup := a.Data("encodeLookup", bytes.Join([][]byte{
+		repeat(0x70, 16),
+		repeat(16, 16),
 	}, nil))
-	lookup := a.DataString("encodeLookup",
-		"ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"+
-			"ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_")
 
 	a.NewFunction("encodeASM")
 	a.NoSplit()
@@ -241,10 +316,12 @@ func encodeASM(a *asm.Asm) {
 	src := a.Argument("src", 8)
 	length := a.Argument("len", 8)
 	padding := a.Argument("padding", 4)
-	url := a.Argument("url", 4)
+	alphabet := a.Argument("lookup", 8)
 
 	a.Start()
 
+	bigloop_avx2 := a.NewLabel("bigloop_avx2")
+	bigloop_avx2_preheader := bigloop_avx2.Suffix("preheader")
 	bigloop_avx := a.NewLabel("bigloop_avx")
 	bigloop_sse := a.NewLabel("bigloop_sse")
 	loop := a.NewLabel("loop")
@@ -259,9 +336,9 @@ func encodeASM(a *asm.Asm) {
 
 		ret, tail,
 
-		asm.Address(asm.R14, 0), asm.Address(asm.R14, 16), asm.Address(asm.R14, 32), asm.Address(asm.R14, 48),
+		[4]asm.Operand{asm.X8, asm.X9, asm.X10, asm.X11},
 
-		asm.X11, asm.X12, asm.X13, asm.X14, asm.X15,
+		asm.X12, asm.X13,
 
 		shuf, shufOut, and,
 	}
@@ -270,13 +347,7 @@ func encodeASM(a *asm.Asm) {
 	a.Movq(e.si, src)
 	a.Movq(e.cx, length)
 	a.Movl(asm.AX, padding)
-	a.Xorq(asm.R14, asm.R14)
-	a.Movb(asm.R14, url)
-
-	a.Shlq(asm.R14, asm.Constant(3))
-
-	a.Movq(asm.DX, lookup.Address())
-	a.Leaq(asm.DX, asm.Address(asm.DX, asm.R14, asm.SX8))
+	a.Movq(asm.DX, alphabet)
 
 	a.Cmpq(asm.Constant(3), e.cx)
 	a.Jb(tail)
@@ -284,21 +355,26 @@ func encodeASM(a *asm.Asm) {
 	a.Cmpq(asm.Constant(16), e.cx)
 	a.Jb(loop_preheader)
 
-	a.Shrq(asm.R14, asm.Constant(1))
+	a.Cmpb(asm.Constant(loopSSE), encodeLoop)
+	a.Jb(loop_preheader)
+
+	for i, r := range e.lookup {
+		a.Movou(r, asm.Address(asm.DX, 16*i))
+	}
 
-	a.Movou(e.baseUpper, base.Offset(0))
-	a.Movou(e.baseLower, base.Offset(16))
-	a.Movou(e.baseZero, base.Offset(32))
-	a.Movq(asm.R13, base.Address())
-	a.Movou(e.base62, asm.Address(asm.R13, asm.R14, asm.SX8, 48))
-	a.Movou(e.base63, asm.Address(asm.R13, asm.R14, asm.SX8, 64))
+	a.Movou(e.saturate, lookup.Offset(0))
+	a.Movou(e.step, lookup.Offset(16))
 
-	a.Movq(asm.R14, compare.Address())
+	a.Cmpb(asm.Constant(loopAVX), encodeLoop)
+	a.Jb(bigloop_sse)
 
-	a.Cmpb(asm.Constant(1), asm.Data("runtime·support_avx"))
-	a.Jne(bigloop_sse)
+	a.Cmpq(asm.Constant(24+4), e.cx)
+	a.Jb(bigloop_avx)
 
-	e.BigLoop(bigloop_avx, a.Vpand, a.Vpcmpgtb, a.Vpcmpeqb, a.Vpblendvb)
+	a.Cmpb(asm.Constant(loopAVX2), encodeLoop)
+	a.Jae(bigloop_avx2_preheader)
+
+	e.BigLoop(bigloop_avx, a.Vpand, a.Vpaddusb, a.Vpshufb)
 
 	a.Label(loop_preheader)
 	a.Xorq(asm.R9, asm.R9)
@@ -400,8 +476,51 @@ func encodeASM(a *asm.Asm) {
 	a.Label(ret)
 	a.Ret()
 
-	e.BigLoop(bigloop_sse, e.vpand_sse, e.vpcmpgtb_sse, e.vpcmpeqb_sse, e.vpblendvb_sse)
+	e.BigLoop(bigloop_sse, e.vpand_sse, e.vpaddusb_sse, e.vpshufb_sse)
 	a.Jmp(loop_preheader)
+
+	a.Label(bigloop_avx2_preheader)
+
+	e2 := &encodeAVX2{
+		e,
+
+		asm.Y4, asm.Y5,
+
+		[4]asm.Operand{asm.Y6, asm.Y7, asm.Y14, asm.Y15},
+		[4]asm.Operand{asm.Y8, asm.Y9, asm.Y10, asm.Y11},
+
+		asm.Y12, asm.Y13,
+	}
+
+	for i, r := range e2.lookup {
+		a.Vbroadcasti128(r, asm.Address(asm.DX, 16*i))
+	}
+
+	for _, c := range []struct {
+		data asm.Data
+		regs []asm.Operand
+	}{
+		{shuf, []asm.Operand{e2.shuf}},
+		{shufOut, []asm.Operand{e2.shufOut}},
+		{and, e2.and[:]},
+		{lookup, []asm.Operand{e2.saturate, e2.step}},
+	} {
+		a.Leaq(asm.R8, c.data)
+
+		for i, r := range c.regs {
+			a.Vbroadcasti128(r, asm.Address(asm.R8, 16*i))
+		}
+	}
+
+	e2.BigLoop(bigloop_avx2)
+
+	a.Cmpq(asm.Constant(16), e.cx)
+	a.Jae(bigloop_avx)
+
+	a.Cmpq(asm.Constant(3), e.cx)
+	a.Jae(loop_preheader)
+
+	a.Jmp(tail)
 }
 
 type decode struct {
@@ -409,104 +528,296 @@ type decode struct {
 
 	di, si, cx asm.Register
 
-	ret, invalid asm.Label
+	loop, invalid asm.Label
 
-	lowerBound, upperBound asm.Operand
+	lowerBound, upperBound, shifts asm.Operand
 
-	shifts asm.Operand
+	special, specialShift asm.Operand
 
 	nibble asm.Operand
 
-	x2f, x2fOffset asm.Operand
+	mergeBytes, mergeWords, shufOut asm.Operand
 
-	mergeBytes, mergeWords asm.Operand
+	translateFrom, translateDelta asm.Operand
 }
 
-func (d *decode) Convert() {
+// Translate adds translateDelta to each character in X1 that equals the
+// entry of translateFrom selected by its high nibble, so that an alphabet
+// with more than one spelling of a value can use the tables of another.
+func (d *decode) Translate() {
+	d.Vpsrld(asm.X2, asm.X1, asm.Constant(4))
+	d.Pand(asm.X2, d.nibble)
+
+	d.Vpshufb(asm.X3, d.translateFrom, asm.X2)
+	d.Vpshufb(asm.X4, d.translateDelta, asm.X2)
+
+	d.Vpcmpeqb(asm.X3, asm.X3, asm.X1)
+	d.Pand(asm.X3, asm.X4)
+
+	d.Paddb(asm.X1, asm.X3)
+}
+
+// Classify leaves the mask of characters in X1 that are not in the
+// alphabet in AX, the high nibble of each character in X2 and the mask
+// of the special character in X5.
+func (d *decode) Classify() {
 	d.Vpsrld(asm.X2, asm.X1, asm.Constant(4))
 	d.Pand(asm.X2, d.nibble)
 
 	d.Vpshufb(asm.X3, d.lowerBound, asm.X2)
-	d.Vpshufb(asm.X0, d.upperBound, asm.X2)
+	d.Vpshufb(asm.X4, d.upperBound, asm.X2)
 
-	d.Vpcmpgtb(asm.X4, asm.X3, asm.X1)
-	d.Vpcmpgtb(asm.X5, asm.X1, asm.X0)
-	d.Vpcmpeqb(asm.X6, asm.X1, d.x2f)
+	d.Vpcmpgtb(asm.X3, asm.X3, asm.X1)
+	d.Vpcmpgtb(asm.X4, asm.X1, asm.X4)
+	d.Vpcmpeqb(asm.X5, asm.X1, d.special)
 
-	d.Por(asm.X4, asm.X5)
-	d.Pandn(asm.X6, asm.X4)
+	d.Por(asm.X3, asm.X4)
+	d.Vpandn(asm.X4, asm.X5, asm.X3)
 
-	d.Pmovmskb(asm.AX, asm.X6)
+	d.Pmovmskb(asm.AX, asm.X4)
+}
 
-	/*d.Testw(asm.DX, asm.AX)
-	d.Jnz(d.invalid)*/
+func (d *decode) Convert() {
+	d.Classify()
 
-	d.Vpshufb(asm.X7, d.shifts, asm.X2)
+	d.Testl(asm.AX, asm.AX)
+	d.Jnz(d.loop)
 
-	d.Psubb(asm.X1, asm.X0)
-	d.Paddb(asm.X1, asm.X7)
+	d.Vpshufb(asm.X2, d.shifts, asm.X2)
+	d.Pand(asm.X5, d.specialShift)
 
-	d.Pand(asm.X6, d.x2fOffset)
-	d.Paddb(asm.X1, asm.X7)
+	d.Paddb(asm.X1, asm.X2)
+	d.Paddb(asm.X1, asm.X5)
 
 	d.Pmaddubsw(asm.X1, d.mergeBytes)
 	d.Pmaddwl(asm.X1, d.mergeWords)
+
+	d.Pshufb(asm.X1, d.shufOut)
 }
 
-func (d *decode) BigLoop(l asm.Label) {
+func (d *decode) BigLoop(l asm.Label, translate bool) {
 	d.Label(l)
 
 	d.Movou(asm.X1, asm.Address(d.si))
 
+	if translate {
+		d.Translate()
+	}
+
 	d.Convert()
 
 	d.Movou(asm.Address(d.di), asm.X1)
 
 	d.Subq(d.cx, asm.Constant(16))
-	d.Jz(d.ret)
 
 	d.Addq(d.si, asm.Constant(16))
 	d.Addq(d.di, asm.Constant(12))
 
-	return
-
 	d.Cmpq(asm.Constant(16+8), d.cx)
 	d.Jae(l)
 }
 
+// ValidLoop checks 16 characters per iteration, and jumps to invalid if
+// any of them are not in the alphabet.
+func (d *decode) ValidLoop(l, invalid asm.Label, translate bool) {
+	d.Label(l)
+
+	d.Movou(asm.X1, asm.Address(d.si))
+
+	if translate {
+		d.Translate()
+	}
+
+	d.Classify()
+
+	d.Testl(asm.AX, asm.AX)
+	d.Jnz(invalid)
+
+	d.Subq(d.cx, asm.Constant(16))
+	d.Addq(d.si, asm.Constant(16))
+
+	d.Cmpq(asm.Constant(16), d.cx)
+	d.Jae(l)
+}
+
+// decodeAVX2 holds the ymm registers used by the AVX2 loop of decodeASM.
+type decodeAVX2 struct {
+	*decode
+
+	lowerBound, upperBound, shifts asm.Operand
+
+	special, specialShift asm.Operand
+
+	nibble asm.Operand
+
+	mergeBytes, mergeWords, shufOut asm.Operand
+
+	translateFrom, translateDelta asm.Operand
+}
+
+// Translate is decode.Translate for Y1.
+func (d *decodeAVX2) Translate() {
+	d.Vpsrld(asm.Y2, asm.Y1, asm.Constant(4))
+	d.Vpand(asm.Y2, asm.Y2, d.nibble)
+
+	d.Vpshufb(asm.Y3, d.translateFrom, asm.Y2)
+	d.Vpshufb(asm.Y4, d.translateDelta, asm.Y2)
+
+	d.Vpcmpeqb(asm.Y3, asm.Y3, asm.Y1)
+	d.Vpand(asm.Y3, asm.Y3, asm.Y4)
+
+	d.Vpaddb(asm.Y1, asm.Y1, asm.Y3)
+}
+
+// Classify is decode.Classify for Y1.
+func (d *decodeAVX2) Classify() {
+	d.Invalid(asm.Y4)
+
+	d.Vpmovmskb(asm.AX, asm.Y4)
+}
+
+// Invalid sets the bytes of mask for characters in Y1 that are not in
+// the alphabet. It leaves the high nibble of each character in Y2 and the
+// mask of the special character in Y5.
+func (d *decodeAVX2) Invalid(mask asm.Operand) {
+	d.Vpsrld(asm.Y2, asm.Y1, asm.Constant(4))
+	d.Vpand(asm.Y2, asm.Y2, d.nibble)
+
+	d.Vpshufb(asm.Y3, d.lowerBound, asm.Y2)
+	d.Vpshufb(asm.Y4, d.upperBound, asm.Y2)
+
+	d.Vpcmpgtb(asm.Y3, asm.Y3, asm.Y1)
+	d.Vpcmpgtb(asm.Y4, asm.Y1, asm.Y4)
+	d.Vpcmpeqb(asm.Y5, asm.Y1, d.special)
+
+	d.Vpor(asm.Y3, asm.Y3, asm.Y4)
+	d.Vpandn(mask, asm.Y5, asm.Y3)
+}
+
+// Convert is decode.Convert for Y1. Rather than falling back to the scalar
+// loop, it leaves the mask of invalid characters in AX.
+func (d *decodeAVX2) Convert() {
+	d.Classify()
+
+	d.Vpshufb(asm.Y2, d.shifts, asm.Y2)
+	d.Vpand(asm.Y5, asm.Y5, d.specialShift)
+
+	d.Vpaddb(asm.Y1, asm.Y1, asm.Y2)
+	d.Vpaddb(asm.Y1, asm.Y1, asm.Y5)
+
+	d.Vpmaddubsw(asm.Y1, asm.Y1, d.mergeBytes)
+	d.Vpmaddwd(asm.Y1, asm.Y1, d.mergeWords)
+
+	d.Vpshufb(asm.Y1, asm.Y1, d.shufOut)
+}
+
+// BigLoop decodes 32 characters into 24 bytes per iteration. Each lane
+// is stored separately and, like decode.BigLoop, writes 4 bytes past its
+// output, so 8 characters must remain after each iteration.
+//
+// The output is stored even if some characters were invalid, so that
+// every quantum before the first invalid character is decoded when it
+// jumps to invalid.
+func (d *decodeAVX2) BigLoop(l, invalid asm.Label, translate bool) {
+	d.Label(l)
+
+	d.Vmovdqu(asm.Y1, asm.Address(d.si))
+
+	if translate {
+		d.Translate()
+	}
+
+	d.Convert()
+
+	d.Vmovdqu(asm.Address(d.di), asm.X1)
+	d.Vextracti128(asm.Address(d.di, 12), asm.Y1, asm.Constant(1))
+
+	d.Testl(asm.AX, asm.AX)
+	d.Jnz(invalid)
+
+	d.Subq(d.cx, asm.Constant(32))
+
+	d.Addq(d.si, asm.Constant(32))
+	d.Addq(d.di, asm.Constant(24))
+
+	d.Cmpq(asm.Constant(32+8), d.cx)
+	d.Jae(l)
+
+	d.Vzeroupper()
+}
+
+// ValidLoop4 checks 128 characters per iteration, merging the masks of
+// each 32 characters in Y7 so that only one branch is taken. If any of
+// them are not in the alphabet, it jumps to retry to find which.
+func (d *decodeAVX2) ValidLoop4(l, retry asm.Label, translate bool) {
+	d.Label(l)
+
+	for i := 0; i < 4; i++ {
+		d.Vmovdqu(asm.Y1, asm.Address(d.si, 32*i))
+
+		if translate {
+			d.Translate()
+		}
+
+		if i == 0 {
+			d.Invalid(asm.Y7)
+		} else {
+			d.Invalid(asm.Y4)
+			d.Vpor(asm.Y7, asm.Y7, asm.Y4)
+		}
+	}
+
+	d.Vpmovmskb(asm.AX, asm.Y7)
+
+	d.Testl(asm.AX, asm.AX)
+	d.Jnz(retry)
+
+	d.Subq(d.cx, asm.Constant(128))
+	d.Addq(d.si, asm.Constant(128))
+
+	d.Cmpq(asm.Constant(128), d.cx)
+	d.Jae(l)
+}
+
+// ValidLoop is decode.ValidLoop for 32 characters per iteration.
+func (d *decodeAVX2) ValidLoop(l, invalid asm.Label, translate bool) {
+	d.Label(l)
+
+	d.Vmovdqu(asm.Y1, asm.Address(d.si))
+
+	if translate {
+		d.Translate()
+	}
+
+	d.Classify()
+
+	d.Testl(asm.AX, asm.AX)
+	d.Jnz(invalid)
+
+	d.Subq(d.cx, asm.Constant(32))
+	d.Addq(d.si, asm.Constant(32))
+
+	d.Cmpq(asm.Constant(32), d.cx)
+	d.Jae(l)
+}
+
 func decodeASM(a *asm.Asm) {
-	var linv, hinv byte = 1, 0
-	lowerBound := a.Data("decodeLowerBound", []byte{
-		linv, linv, 0x2b, 0x30,
-		0x40, 0x50, 0x61, 0x70,
-		linv, linv, linv, linv,
-		linv, linv, linv, linv,
-	})
-	upperBound := a.Data("decodeUpperBound", []byte{
-		hinv, hinv, 0x2b, 0x39,
-		0x4f, 0x5a, 0x6f, 0x7a,
-		hinv, hinv, hinv, hinv,
-		hinv, hinv, hinv, hinv,
-	})
-	shifts := a.Data("decodeShifts", []byte{
-		0x00, 0x00, 0x3e, 0x34,
-		0x00, 0x0f, 0x1a, 0x29,
-		0x00, 0x00, 0x00, 0x00,
-		0x00, 0x00, 0x00, 0x00,
-	})
 	nibble := a.Data("decodeNibble", repeat(0x0f, 16))
-	x2f := a.Data("decode2f", repeat(0x2f, 16))
-	var c3 byte = 3
-	x2fOffset := a.Data("decode2fOffset", repeat(-c3, 16))
 	merge := a.Data32("decodeMerge", []uint32{
-		0x40014001,
-		0x40014001,
-		0x40014001,
-		0x40014001,
-		0x10000001,
-		0x10000001,
-		0x10000001,
-		0x10000001,
+		0x01400140,
+		0x01400140,
+		0x01400140,
+		0x01400140,
+		0x00011000,
+		0x00011000,
+		0x00011000,
+		0x00011000,
+	})
+	shufOut := a.Data32("decodeShufOut", []uint32{
+		0x06000102,
+		0x090a0405,
+		0x0c0d0e08,
+		0xffffffff,
 	})
 
 	a.NewFunction("decodeASM")
@@ -515,15 +826,24 @@ func decodeASM(a *asm.Asm) {
 	dst := a.Argument("dst", 8)
 	src := a.Argument("src", 8)
 	length := a.Argument("len", 8)
-	padding := a.Argument("padding", 4)
-	url := a.Argument("url", 4)
+	lookup := a.Argument("lookup", 8)
+	vector := a.Argument("vector", 8)
+	translate := a.Argument("translate", 8)
 	n := a.Argument("n", 8)
 	ok := a.Argument("ok", 4)
 
 	a.Start()
 
+	bigloop_avx2 := a.NewLabel("bigloop_avx2")
+	bigloop_avx2_preheader := bigloop_avx2.Suffix("preheader")
+	bigloop_avx2_invalid := bigloop_avx2.Suffix("invalid")
 	bigloop_avx := a.NewLabel("bigloop_avx")
+	bigloop_avx2_translate := a.NewLabel("bigloop_avx2_translate")
+	bigloop_avx2_translate_preheader := bigloop_avx2_translate.Suffix("preheader")
+	bigloop_avx_translate := a.NewLabel("bigloop_avx_translate")
+	bigloop_avx_translate_preheader := bigloop_avx_translate.Suffix("preheader")
 	loop := a.NewLabel("loop")
+	tail := a.NewLabel("tail")
 	ret := a.NewLabel("ret")
 	invalid := a.NewLabel("invalid")
 
@@ -532,50 +852,150 @@ func decodeASM(a *asm.Asm) {
 
 		asm.DI, asm.SI, asm.BX,
 
-		ret, invalid,
+		loop, invalid,
 
-		asm.X13, asm.X14,
+		asm.X13, asm.X14, asm.X15,
 
-		asm.X15,
+		asm.X12, asm.X11,
 
 		nibble,
 
-		x2f, x2fOffset,
+		asm.X10, asm.X9, shufOut,
 
-		asm.Address(asm.R15, 0), asm.Address(asm.R15, 16),
+		asm.X0, asm.X6,
 	}
 
 	a.Movq(d.di, dst)
 	a.Movq(d.si, src)
 	a.Movq(d.cx, length)
-	a.Movl(asm.DX, padding)
-	a.Movb(asm.AX, url)
+	a.Movq(asm.DX, lookup)
+	a.Movq(asm.R15, vector)
 
-	a.Movq(asm.R14, d.si)
-	a.Movq(asm.R15, d.di)
+	a.Movq(asm.R8, d.si)
+	a.Movq(asm.R9, d.di)
 
-	a.Movw(asm.DX, asm.Constant(0xffff))
+	a.Xorq(asm.R10, asm.R10)
+	a.Xorq(asm.R11, asm.R11)
+	a.Xorq(asm.R12, asm.R12)
+	a.Xorq(asm.R13, asm.R13)
 
 	a.Cmpq(asm.Constant(16+8), d.cx)
 	a.Jb(loop)
 
-	a.Movq(asm.R15, merge.Address())
-	a.Movq(d.lowerBound, lowerBound)
-	a.Movq(d.upperBound, upperBound)
-	a.Movq(d.shifts, shifts)
+	a.Testq(asm.R15, asm.R15)
+	a.Jz(loop)
+
+	a.Cmpb(asm.Constant(loopAVX), decodeLoop)
+	a.Jb(loop)
+
+	a.Movou(d.lowerBound, asm.Address(asm.R15))
+	a.Movou(d.upperBound, asm.Address(asm.R15, 16))
+	a.Movou(d.shifts, asm.Address(asm.R15, 32))
+	a.Movou(d.special, asm.Address(asm.R15, 48))
+	a.Movou(d.specialShift, asm.Address(asm.R15, 64))
+	a.Movou(d.mergeBytes, merge.Offset(0))
+	a.Movou(d.mergeWords, merge.Offset(16))
+
+	a.Movq(asm.CX, translate)
+	a.Testq(asm.CX, asm.CX)
+	a.Jnz(bigloop_avx_translate_preheader)
 
-	d.BigLoop(bigloop_avx)
+	a.Cmpq(asm.Constant(32+8), d.cx)
+	a.Jb(bigloop_avx)
+
+	a.Cmpb(asm.Constant(loopAVX2), decodeLoop)
+	a.Jae(bigloop_avx2_preheader)
+
+	d.BigLoop(bigloop_avx, false)
 
 	a.Label(loop)
 
-	// loop
+	a.Cmpq(asm.Constant(4), d.cx)
+	a.Jb(tail)
 
-	a.Xorq(asm.AX, asm.AX)
-	a.Jmp(invalid)
+	for i, r := range []asm.Register{asm.R10, asm.R11, asm.R12, asm.R13} {
+		a.Movb(r, asm.Address(d.si, i))
+		a.Movb(r, asm.Address(asm.DX, r, asm.SX1))
+
+		a.Movl(asm.AX, asm.Constant(1<<uint(i)))
+		a.Cmpb(asm.Constant(0xff), r)
+		a.Je(invalid)
+	}
+
+	a.Shlb(asm.R10, asm.Constant(2))
+	a.Movb(asm.R14, asm.R11)
+	a.Shrb(asm.R14, asm.Constant(4))
+	a.Orb(asm.R10, asm.R14)
+
+	a.Shlb(asm.R11, asm.Constant(4))
+	a.Movb(asm.R14, asm.R12)
+	a.Shrb(asm.R14, asm.Constant(2))
+	a.Orb(asm.R11, asm.R14)
+
+	a.Shlb(asm.R12, asm.Constant(6))
+	a.Orb(asm.R12, asm.R13)
+
+	for i, r := range []asm.Register{asm.R10, asm.R11, asm.R12} {
+		a.Movb(asm.Address(d.di, i), r)
+	}
+
+	a.Subq(d.cx, asm.Constant(4))
+
+	a.Addq(d.si, asm.Constant(4))
+	a.Addq(d.di, asm.Constant(3))
+
+	a.Jmp(loop)
+
+	a.Label(tail)
+
+	tail1 := tail.Suffix("1")
+
+	a.Testq(d.cx, d.cx)
+	a.Jz(ret)
+
+	a.Movl(asm.AX, asm.Constant(1))
+	a.Cmpq(asm.Constant(2), d.cx)
+	a.Jb(invalid)
+
+	for i, r := range []asm.Register{asm.R10, asm.R11} {
+		a.Movb(r, asm.Address(d.si, i))
+		a.Movb(r, asm.Address(asm.DX, r, asm.SX1))
+
+		a.Movl(asm.AX, asm.Constant(1<<uint(i)))
+		a.Cmpb(asm.Constant(0xff), r)
+		a.Je(invalid)
+	}
+
+	a.Cmpq(asm.Constant(3), d.cx)
+	a.Jb(tail1)
+
+	a.Movb(asm.R12, asm.Address(d.si, 2))
+	a.Movb(asm.R12, asm.Address(asm.DX, asm.R12, asm.SX1))
+
+	a.Movl(asm.AX, asm.Constant(4))
+	a.Cmpb(asm.Constant(0xff), asm.R12)
+	a.Je(invalid)
+
+	a.Movb(asm.R14, asm.R11)
+	a.Shlb(asm.R14, asm.Constant(4))
+	a.Shrb(asm.R12, asm.Constant(2))
+	a.Orb(asm.R14, asm.R12)
+
+	a.Movb(asm.Address(d.di, 1), asm.R14)
+
+	a.Label(tail1)
+
+	a.Shlb(asm.R10, asm.Constant(2))
+	a.Shrb(asm.R11, asm.Constant(4))
+	a.Orb(asm.R10, asm.R11)
+
+	a.Movb(asm.Address(d.di), asm.R10)
+
+	a.Leaq(d.di, asm.Address(d.di, d.cx, asm.SX1, -1))
 
 	a.Label(ret)
 
-	a.Subq(d.di, asm.R15)
+	a.Subq(d.di, asm.R9)
 
 	a.Movq(n, d.di)
 	a.Movb(ok, asm.Constant(1))
@@ -584,15 +1004,295 @@ func decodeASM(a *asm.Asm) {
 
 	a.Label(invalid)
 
-	a.Bsfw(asm.AX, asm.AX)
+	a.Bsfl(asm.AX, asm.AX)
 
-	a.Subq(d.si, asm.R14)
+	a.Subq(d.si, asm.R8)
 	a.Addq(asm.AX, d.si)
 
 	a.Movq(n, asm.AX)
 	a.Movb(ok, asm.Constant(0))
 
 	a.Ret()
+
+	a.Label(bigloop_avx2_preheader)
+
+	d2 := &decodeAVX2{
+		d,
+
+		asm.Y13, asm.Y14, asm.Y15,
+
+		asm.Y12, asm.Y11,
+
+		asm.Y8,
+
+		asm.Y10, asm.Y9, asm.Y7,
+
+		asm.Y0, asm.Y6,
+	}
+
+	// The low lanes of the ymm registers hold the same tables as the xmm
+	// registers of d, so the 128-bit loop may follow the AVX2 loop.
+	broadcast := func() {
+		for i, r := range []asm.Operand{d2.lowerBound, d2.upperBound, d2.shifts, d2.special, d2.specialShift} {
+			a.Vbroadcasti128(r, asm.Address(asm.R15, 16*i))
+		}
+
+		for _, c := range []struct {
+			data asm.Data
+			regs []asm.Operand
+		}{
+			{nibble, []asm.Operand{d2.nibble}},
+			{merge, []asm.Operand{d2.mergeBytes, d2.mergeWords}},
+			{shufOut, []asm.Operand{d2.shufOut}},
+		} {
+			a.Leaq(asm.R14, c.data)
+
+			for i, r := range c.regs {
+				a.Vbroadcasti128(r, asm.Address(asm.R14, 16*i))
+			}
+		}
+	}
+
+	broadcast()
+
+	d2.BigLoop(bigloop_avx2, bigloop_avx2_invalid, false)
+
+	a.Cmpq(asm.Constant(16+8), d.cx)
+	a.Jae(bigloop_avx)
+
+	a.Jmp(loop)
+
+	a.Label(bigloop_avx_translate_preheader)
+
+	a.Movou(d.translateFrom, asm.Address(asm.CX))
+	a.Movou(d.translateDelta, asm.Address(asm.CX, 16))
+
+	a.Cmpq(asm.Constant(32+8), d.cx)
+	a.Jb(bigloop_avx_translate)
+
+	a.Cmpb(asm.Constant(loopAVX2), decodeLoop)
+	a.Jae(bigloop_avx2_translate_preheader)
+
+	d.BigLoop(bigloop_avx_translate, true)
+
+	a.Jmp(loop)
+
+	a.Label(bigloop_avx2_translate_preheader)
+
+	broadcast()
+
+	a.Vbroadcasti128(d2.translateFrom, asm.Address(asm.CX))
+	a.Vbroadcasti128(d2.translateDelta, asm.Address(asm.CX, 16))
+
+	d2.BigLoop(bigloop_avx2_translate, bigloop_avx2_invalid, true)
+
+	a.Cmpq(asm.Constant(16+8), d.cx)
+	a.Jae(bigloop_avx_translate)
+
+	a.Jmp(loop)
+
+	a.Label(bigloop_avx2_invalid)
+
+	a.Vzeroupper()
+	a.Jmp(invalid)
+
+	validASM(a, nibble)
+}
+
+// validASM returns the number of characters at the start of src that the
+// SIMD loops found to be in the alphabet. It checks whole blocks of 16 or
+// 32 characters, and leaves the rest and any block that contains an
+// invalid character to the caller.
+func validASM(a *asm.Asm, nibble asm.Data) {
+	a.NewFunction("validASM")
+	a.NoSplit()
+
+	src := a.Argument("src", 8)
+	length := a.Argument("len", 8)
+	vector := a.Argument("vector", 8)
+	translate := a.Argument("translate", 8)
+	n := a.Argument("n", 8)
+
+	a.Start()
+
+	ret := a.NewLabel("ret")
+	translateLabel := a.NewLabel("translate")
+	bigloop_avx2_invalid := a.NewLabel("bigloop_avx2_invalid")
+
+	d := &decode{
+		Asm: a,
+
+		si: asm.SI,
+		cx: asm.BX,
+
+		lowerBound: asm.X13,
+		upperBound: asm.X14,
+		special:    asm.X12,
+		nibble:     nibble,
+
+		translateFrom:  asm.X0,
+		translateDelta: asm.X6,
+	}
+
+	d2 := &decodeAVX2{
+		decode: d,
+
+		lowerBound: asm.Y13,
+		upperBound: asm.Y14,
+		special:    asm.Y12,
+		nibble:     asm.Y8,
+
+		translateFrom:  asm.Y0,
+		translateDelta: asm.Y6,
+	}
+
+	a.Movq(d.si, src)
+	a.Movq(d.cx, length)
+	a.Movq(asm.R15, vector)
+	a.Movq(asm.CX, translate)
+
+	a.Movq(asm.R8, d.si)
+
+	a.Cmpq(asm.Constant(16), d.cx)
+	a.Jb(ret)
+
+	a.Testq(asm.R15, asm.R15)
+	a.Jz(ret)
+
+	a.Cmpb(asm.Constant(loopAVX), decodeLoop)
+	a.Jb(ret)
+
+	a.Testq(asm.CX, asm.CX)
+	a.Jnz(translateLabel)
+
+	for _, translate := range []bool{false, true} {
+		bigloop_avx := a.NewLabel("bigloop_avx")
+		bigloop_avx2 := a.NewLabel("bigloop_avx2")
+
+		if translate {
+			a.Label(translateLabel)
+
+			bigloop_avx = bigloop_avx.Suffix("translate")
+			bigloop_avx2 = bigloop_avx2.Suffix("translate")
+		}
+
+		bigloop_avx_preheader := bigloop_avx.Suffix("preheader")
+		bigloop_avx2_preheader := bigloop_avx2.Suffix("preheader")
+
+		a.Cmpq(asm.Constant(32), d.cx)
+		a.Jb(bigloop_avx_preheader)
+
+		a.Cmpb(asm.Constant(loopAVX2), decodeLoop)
+		a.Jae(bigloop_avx2_preheader)
+
+		a.Label(bigloop_avx_preheader)
+
+		a.Movou(d.lowerBound, asm.Address(asm.R15))
+		a.Movou(d.upperBound, asm.Address(asm.R15, 16))
+		a.Movou(d.special, asm.Address(asm.R15, 48))
+
+		if translate {
+			a.Movou(d.translateFrom, asm.Address(asm.CX))
+			a.Movou(d.translateDelta, asm.Address(asm.CX, 16))
+		}
+
+		d.ValidLoop(bigloop_avx, ret, translate)
+
+		a.Jmp(ret)
+
+		// The low lanes of the ymm registers hold the same tables as
+		// the xmm registers of d, so the 128-bit loop may follow the
+		// AVX2 loop.
+		a.Label(bigloop_avx2_preheader)
+
+		a.Vbroadcasti128(d2.lowerBound, asm.Address(asm.R15))
+		a.Vbroadcasti128(d2.upperBound, asm.Address(asm.R15, 16))
+		a.Vbroadcasti128(d2.special, asm.Address(asm.R15, 48))
+
+		a.Leaq(asm.R14, nibble)
+		a.Vbroadcasti128(d2.nibble, asm.Address(asm.R14))
+
+		if translate {
+			a.Vbroadcasti128(d2.translateFrom, asm.Address(asm.CX))
+			a.Vbroadcasti128(d2.translateDelta, asm.Address(asm.CX, 16))
+		}
+
+		bigloop_avx2_unrolled := bigloop_avx2.Suffix("unrolled")
+		bigloop_avx2_tail := bigloop_avx2.Suffix("tail")
+
+		a.Cmpq(asm.Constant(128), d.cx)
+		a.Jb(bigloop_avx2)
+
+		d2.ValidLoop4(bigloop_avx2_unrolled, bigloop_avx2, translate)
+
+		a.Cmpq(asm.Constant(32), d.cx)
+		a.Jb(bigloop_avx2_tail)
+
+		d2.ValidLoop(bigloop_avx2, bigloop_avx2_invalid, translate)
+
+		a.Label(bigloop_avx2_tail)
+
+		a.Vzeroupper()
+
+		a.Cmpq(asm.Constant(16), d.cx)
+		a.Jae(bigloop_avx)
+
+		a.Jmp(ret)
+	}
+
+	a.Label(bigloop_avx2_invalid)
+
+	a.Vzeroupper()
+
+	a.Label(ret)
+
+	a.Subq(d.si, asm.R8)
+	a.Movq(n, d.si)
+
+	a.Ret()
+}
+
+func cpuASM(a *asm.Asm) {
+	a.NewFunction("cpuid")
+	a.NoSplit()
+
+	eaxArg := a.Argument("eaxArg", 4)
+	ecxArg := a.Argument("ecxArg", 4)
+	eax := a.Argument("eax", 4)
+	ebx := a.Argument("ebx", 4)
+	ecx := a.Argument("ecx", 4)
+	edx := a.Argument("edx", 4)
+
+	a.Start()
+
+	a.Movl(asm.AX, eaxArg)
+	a.Movl(asm.CX, ecxArg)
+
+	a.Cpuid()
+
+	a.Movl(eax, asm.AX)
+	a.Movl(ebx, asm.BX)
+	a.Movl(ecx, asm.CX)
+	a.Movl(edx, asm.DX)
+
+	a.Ret()
+
+	a.NewFunction("xgetbv")
+	a.NoSplit()
+
+	eax = a.Argument("eax", 4)
+	edx = a.Argument("edx", 4)
+
+	a.Start()
+
+	a.Xorl(asm.CX, asm.CX)
+
+	a.Xgetbv()
+
+	a.Movl(eax, asm.AX)
+	a.Movl(edx, asm.DX)
+
+	a.Ret()
 }
 
 func main() {
@@ -603,4 +1303,8 @@ func main() {
 	if err := asm.Do("base64_decode_amd64.s", decodeHeader, decodeASM); err != nil {
 		panic(err)
 	}
+
+	if err := asm.Do("cpu_amd64.s", cpuHeader, cpuASM); err != nil {
+		panic(err)
+	}
 }
@@ -3,18 +3,19 @@
 // Modified BSD License license that can be found in
 // the LICENSE file.
 
-// +build amd64,!gccgo,!appengine
-
 // Package base64 is an efficient base64 implementation for Golang.
 package base64
 
-import "errors"
-
-type encodingType int
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
 
 const (
-	encodeStd encodingType = iota
-	encodeURL
+	encodeStd = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+	encodeURL = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
 )
 
 const (
@@ -23,11 +24,660 @@ const (
 )
 
 var (
-	StdEncoding = newEncoding(encodeStd)
-	URLEncoding = newEncoding(encodeURL)
+	StdEncoding = NewEncoding(encodeStd)
+	URLEncoding = NewEncoding(encodeURL)
 
 	RawStdEncoding = StdEncoding.WithPadding(NoPadding)
 	RawURLEncoding = URLEncoding.WithPadding(NoPadding)
+
+	// AnyEncoding decodes both the standard and URL-safe alphabets, even
+	// when they are mixed, with or without padding. It encodes as
+	// StdEncoding does.
+	AnyEncoding = newAnyEncoding()
 )
 
+func newAnyEncoding() Encoding {
+	enc := NewEncoding(encodeStd)
+	enc.alias('-', '+')
+	enc.alias('_', '/')
+	enc.padOptional = true
+	return enc
+}
+
+// ErrFormat is matched by every CorruptInputError with errors.Is.
 var ErrFormat = errors.New("go-base64: invalid input")
+
+// NewEncoding returns a new padded Encoding defined by the given alphabet,
+// which must be a 64-byte string that does not contain the padding character
+// or CR / LF ('\r', '\n'). The alphabet is treated as a sequence of byte
+// values without any special treatment for multi-byte UTF-8.
+func NewEncoding(encoder string) Encoding {
+	if len(encoder) != 64 {
+		panic("encoding alphabet is not 64-bytes long")
+	}
+
+	var seen [256]bool
+	for i := 0; i < len(encoder); i++ {
+		switch c := encoder[i]; {
+		case c == '\n' || c == '\r':
+			panic("encoding alphabet contains newline character")
+		case seen[c]:
+			panic("encoding alphabet includes duplicate symbols")
+		default:
+			seen[c] = true
+		}
+	}
+
+	return Encoding{alphabet: newAlphabet(encoder), padding: StdPadding, ignore: "\r\n"}
+}
+
+// Encoding is a radix 64 encoding/decoding scheme, defined by a
+// 64-character alphabet.
+type Encoding struct {
+	*alphabet
+	padding rune
+	strict  bool
+	ignore  string // bytes skipped by Decode
+
+	padOptional bool // whether Decode accepts unpadded input
+
+	lineWidth int    // zero if lines are not wrapped
+	lineSep   string // separator written between lines
+}
+
+// WithPadding creates a new encoding identical to enc except
+// with a specified padding character, or NoPadding to disable padding.
+// The padding character must not be '\r' or '\n', must not
+// be contained in the encoding's alphabet and must be a rune equal or
+// below '\xff'.
+func (enc Encoding) WithPadding(padding rune) Encoding {
+	switch {
+	case padding < NoPadding || padding == '\r' || padding == '\n' || padding > 0xff:
+		panic("invalid padding")
+	case padding != NoPadding && enc.decodeMap[byte(padding)] != invalidIndex:
+		panic("padding contained in alphabet")
+	case padding != NoPadding && strings.ContainsRune(enc.lineSep, padding):
+		panic("padding contained in line separator")
+	case padding != NoPadding && strings.ContainsRune(enc.ignore, padding):
+		panic("padding contained in ignored characters")
+	}
+
+	enc.padding = padding
+	return enc
+}
+
+// Strict creates a new encoding identical to enc except with
+// strict decoding enabled. In this mode, the decoder requires that
+// trailing padding bits are zero, as described in RFC 4648 section 3.5.
+func (enc Encoding) Strict() Encoding {
+	enc.strict = true
+	return enc
+}
+
+// WithIgnore creates a new encoding identical to enc except that Decode
+// skips the bytes in chars wherever they appear in the input, instead of
+// the default of CR and LF ('\r', '\n'). An empty chars makes Decode
+// reject any byte that is not in the alphabet or the padding character.
+// The bytes must not be the padding character or in the alphabet.
+func (enc Encoding) WithIgnore(chars string) Encoding {
+	for i := 0; i < len(chars); i++ {
+		if enc.inAlphabet(chars[i]) || enc.isPadding(chars[i]) {
+			panic("ignored character contained in alphabet")
+		}
+	}
+
+	enc.ignore = chars
+	return enc
+}
+
+func (enc Encoding) EncodeToString(src []byte) string {
+	buf := make([]byte, enc.EncodedLen(len(src)))
+	enc.Encode(buf, src)
+	return string(buf)
+}
+
+func (enc Encoding) EncodedLen(n int) int {
+	l := enc.encodedLen(n)
+	if enc.lineWidth != 0 && l != 0 {
+		l += (l - 1) / enc.lineWidth * len(enc.lineSep)
+	}
+
+	return l
+}
+
+// encodedLen returns the length of the encoding of n bytes
+// without line separators.
+func (enc Encoding) encodedLen(n int) int {
+	if enc.padding == NoPadding {
+		return (n*8 + 5) / 6 // minimum # chars at 6 bits per char
+	}
+
+	return (n + 2) / 3 * 4 // minimum # 4-char quanta, 3 bytes each
+}
+
+// AppendEncode appends the base64 encoding of src to dst and returns the
+// extended buffer. dst is grown at most once.
+func (enc Encoding) AppendEncode(dst, src []byte) []byte {
+	n := enc.EncodedLen(len(src))
+	dst = grow(dst, n)
+
+	enc.Encode(dst[len(dst):len(dst)+n], src)
+	return dst[:len(dst)+n]
+}
+
+// AppendDecode appends the base64 decoding of src to dst and returns the
+// extended buffer. dst is grown at most once. If the input is malformed,
+// it returns the bytes decoded before the error and the error.
+func (enc Encoding) AppendDecode(dst, src []byte) ([]byte, error) {
+	n := enc.decodedLen(src)
+	dst = grow(dst, n)
+
+	n, err := enc.Decode(dst[len(dst):len(dst)+n], src)
+	return dst[:len(dst)+n], err
+}
+
+// grow returns dst with the capacity for at least n more bytes.
+func grow(dst []byte, n int) []byte {
+	if cap(dst)-len(dst) >= n {
+		return dst
+	}
+
+	return append(dst, make([]byte, n)...)[:len(dst)]
+}
+
+func (enc Encoding) DecodeString(s string) ([]byte, error) {
+	src := []byte(s)
+	dbuf := make([]byte, enc.decodedLen(src))
+	n, err := enc.Decode(dbuf, src)
+	return dbuf[:n], err
+}
+
+func (enc Encoding) DecodedLen(n int) int {
+	if enc.padding == NoPadding || enc.padOptional {
+		// Unpadded data may end with partial block of 2-3 characters.
+		return (n*6 + 7) / 8
+	}
+
+	// Padded base64 should always be a multiple of 4 characters in length.
+	return n / 4 * 3
+}
+
+// DecodedLenExact returns the length in bytes of the decoded data
+// corresponding to src. Unlike DecodedLen, it takes any padding into
+// account, so it is exact for valid input. Bytes that enc ignores are
+// counted as characters, so it is only an upper bound for input that
+// contains them. dst must be at least this long for Decode.
+func (enc Encoding) DecodedLenExact(src []byte) int {
+	return enc.decodedLen(src)
+}
+
+// Encode encodes src using the encoding enc, writing
+// EncodedLen(len(src)) bytes to dst. It panics if dst is too short.
+func (enc Encoding) Encode(dst, src []byte) {
+	if len(dst) < enc.EncodedLen(len(src)) {
+		panic("go-base64: output buffer too short")
+	}
+
+	if len(src) != 0 {
+		enc.encodeLines(dst, src, 0)
+	}
+}
+
+// Decode decodes src using the encoding enc. It writes at most
+// DecodedLen(len(src)) bytes to dst and returns the number of bytes
+// written. Bytes that enc ignores, CR and LF unless changed with
+// WithIgnore, are skipped wherever they appear. If dst is shorter than the
+// decoded length of valid input, counting ignored bytes as characters, it
+// writes nothing and returns io.ErrShortBuffer. If src contains invalid
+// base64 data, it will return the number of bytes successfully written
+// and a CorruptInputError.
+func (enc Encoding) Decode(dst, src []byte) (n int, err error) {
+	if len(src) == 0 {
+		return
+	}
+
+	if len(dst) < enc.decodedLen(src) {
+		return 0, io.ErrShortBuffer
+	}
+
+	if enc.lineWidth != 0 {
+		return enc.decodeLines(dst, src)
+	}
+
+	return enc.decodeQuanta(dst, src)
+}
+
+// decodeQuanta decodes src, which must not be wrapped, into dst. Unlike
+// Decode, it only requires that dst has room for the bytes that src
+// decodes to, not for ignored bytes counted as characters, as decode is
+// never given more quanta than the rest of dst holds.
+func (enc Encoding) decodeQuanta(dst, src []byte) (n int, err error) {
+	for si := 0; si < len(src); {
+		// Whole quanta are decoded directly up to the first byte that
+		// is not in the alphabet, which decode finds with a vector
+		// compare where the CPU supports it. Only the quantum that
+		// contains that byte is decoded by decodeQuantum.
+		l := (len(src) - si) &^ 3
+		if m := (len(dst) - n) / 3 * 4; l > m {
+			l = m
+		}
+
+		if l != 0 {
+			nn, ok := enc.decode(dst[n:], src[si:si+l])
+			if ok {
+				n, si = n+nn, si+l
+				continue
+			}
+
+			n, si = n+nn/4*3, si+nn&^3
+		}
+
+		var ninc int
+		si, ninc, err = enc.decodeQuantum(dst[n:], src, si)
+		n += ninc
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// Valid reports whether src is valid base64, that is whether Decode would
+// decode it without error. It only checks the characters of src, without
+// decoding them, so it needs no output buffer and is about two to three
+// times as fast as Decode, though less for input that does not fit in the
+// CPU caches.
+func (enc Encoding) Valid(src []byte) bool {
+	if enc.lineWidth != 0 {
+		return enc.validLines(src)
+	}
+
+	// Most input is whole quanta with no ignored bytes, and any padding
+	// or partial quantum at the end. The quanta before the final quantum
+	// are checked by valid and the final quantum by validFinal.
+	n := len(src) &^ 3
+	if n == len(src) && n != 0 && enc.padding != NoPadding {
+		n -= 4
+	}
+
+	si, ok := enc.valid(src[:n])
+	if ok && enc.validFinal(src[n:]) {
+		return true
+	}
+
+	// Otherwise, the final quantum and any quantum that contains a byte
+	// that is not in the alphabet are decoded into dbuf, as Decode does,
+	// so that padding, ignored bytes and strict are checked.
+	var dbuf [3]byte
+
+	for si &^= 3; si < len(src); {
+		if l := (len(src) - si) &^ 3; l != 0 {
+			nn, ok := enc.valid(src[si : si+l])
+			if ok {
+				si += l
+				continue
+			}
+
+			si += nn &^ 3
+		}
+
+		var err error
+		if si, _, err = enc.decodeQuantum(dbuf[:], src, si); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validFinal reports whether q, the characters after the last whole
+// quantum or the final quantum if it may be padded, is a valid end of
+// the input that contains no ignored bytes. It is false for anything
+// else, which Valid leaves to decodeQuantum.
+func (enc Encoding) validFinal(q []byte) bool {
+	switch len(q) {
+	case 0:
+		return true
+	case 2, 3:
+		if enc.padding != NoPadding && !enc.padOptional {
+			return false
+		}
+	case 4:
+		switch {
+		case !enc.isPadding(q[3]):
+			q = q[:4]
+		case enc.isPadding(q[2]):
+			q = q[:2]
+		default:
+			q = q[:3]
+		}
+	default:
+		return false
+	}
+
+	for _, c := range q {
+		if !enc.inAlphabet(c) {
+			return false
+		}
+	}
+
+	if !enc.strict {
+		return true
+	}
+
+	// The bits of the last character that are not decoded must be zero.
+	switch last := enc.decodeMap[q[len(q)-1]]; len(q) {
+	case 2:
+		return last&0x0f == 0
+	case 3:
+		return last&0x03 == 0
+	}
+
+	return true
+}
+
+// ValidString reports whether s is valid base64, as Valid does.
+func (enc Encoding) ValidString(s string) bool {
+	return enc.Valid([]byte(s))
+}
+
+// ValidPrefix returns the length of the longest prefix of src that is valid
+// base64, as Valid reports, so it returns len(src) if src is valid. Like
+// Valid, it does not decode the whole quanta before the first byte that is
+// not in the alphabet.
+func (enc Encoding) ValidPrefix(src []byte) int {
+	if enc.lineWidth != 0 {
+		if enc.ignore == "" {
+			return enc.validPrefixLines(src)
+		}
+
+		// Input that is not wrapped as expected is checked as if enc
+		// did not wrap lines, which is also how it checks input that
+		// is.
+		enc = enc.skipping()
+	}
+
+	var dbuf [3]byte
+
+	for si := 0; si < len(src); {
+		if l := (len(src) - si) &^ 3; l != 0 {
+			nn, ok := enc.valid(src[si : si+l])
+			if ok {
+				si += l
+				continue
+			}
+
+			si += nn &^ 3
+		}
+
+		nsi, _, err := enc.decodeQuantum(dbuf[:], src, si)
+		if err == nil {
+			si = nsi
+			continue
+		}
+
+		// src[:si] is valid. It may be extended by a final quantum
+		// that ends before the byte at which the error is reported,
+		// and by ignored bytes, which do not change whether a prefix
+		// is valid.
+		end := int(err.(CorruptInputError).Offset)
+		for k := end; k > si; k-- {
+			if enc.ignores(src[k-1]) {
+				continue
+			}
+
+			if _, _, err := enc.decodeQuantum(dbuf[:], src[:k], si); err == nil {
+				return enc.skipIgnored(src[:end], k)
+			}
+		}
+
+		return enc.skipIgnored(src[:end], si)
+	}
+
+	return len(src)
+}
+
+// decodedLen returns the number of bytes that Decode writes for src if it
+// is valid and contains no ignored bytes, which is also the most that
+// Decode writes if it is not.
+func (enc Encoding) decodedLen(src []byte) int {
+	if enc.lineWidth != 0 {
+		lines, last, end := enc.lastLine(src)
+		if enc.ignore != "" && !enc.separated(src, lines) {
+			// Input that is wrapped differently is decoded
+			// as if enc did not wrap lines.
+			return enc.skipping().decodedLen(src)
+		}
+
+		return lines*(enc.lineWidth/4*3) + enc.unwrapped().decodedLen(src[last:end])
+	}
+
+	n := len(src)
+	if enc.padding == NoPadding || enc.padOptional && n%4 != 0 {
+		return n/4*3 + n%4*6/8
+	}
+
+	if n%4 != 0 {
+		// Only the complete quanta can be decoded.
+		return n / 4 * 3
+	}
+
+	pad := 0
+	for pad < 2 && pad < n && enc.isPadding(src[n-1-pad]) {
+		pad++
+	}
+
+	return n/4*3 - pad
+}
+
+// decodeQuantum decodes the quantum that begins at src[si], skipping any
+// ignored bytes, and returns the offset that follows it and the number of
+// bytes written to dst. It is only used for the quantum that decode
+// rejected or could not decode, so it handles padding, the final partial
+// quantum and ignored bytes one byte at a time.
+func (enc Encoding) decodeQuantum(dst, src []byte, si int) (nsi, n int, err error) {
+	var dbuf [4]byte
+	dlen := 4
+
+	for j := 0; j < len(dbuf); j++ {
+		if len(src) == si {
+			switch {
+			case j == 0:
+				return si, 0, nil
+			case j == 1, enc.padding != NoPadding && !enc.padOptional:
+				return si, 0, CorruptInputError{int64(si - j), src[si-j], Truncated}
+			}
+
+			dlen = j
+			break
+		}
+
+		in := src[si]
+		si++
+
+		if out := enc.decodeMap[in]; out != invalidIndex {
+			dbuf[j] = out
+			continue
+		}
+
+		if enc.ignores(in) {
+			j--
+			continue
+		}
+
+		if !enc.isPadding(in) {
+			return si, 0, CorruptInputError{int64(si - 1), in, InvalidCharacter}
+		}
+
+		// We've reached the end and there's padding
+		switch j {
+		case 0, 1:
+			// incorrect padding
+			return si, 0, CorruptInputError{int64(si - 1), in, InvalidPadding}
+		case 2:
+			// "==" is expected, the first "=" is already consumed.
+			si = enc.skipIgnored(src, si)
+			if si == len(src) {
+				// not enough padding
+				return si, 0, CorruptInputError{int64(si), 0, Truncated}
+			}
+
+			if !enc.isPadding(src[si]) {
+				// incorrect padding
+				return si, 0, CorruptInputError{int64(si - 1), src[si-1], InvalidPadding}
+			}
+
+			si++
+		}
+
+		if si = enc.skipIgnored(src, si); si < len(src) {
+			// trailing garbage
+			err = enc.corruptInputError(src, si)
+		}
+
+		dlen = j
+		break
+	}
+
+	// Convert 4x 6bit source bytes into 3 bytes
+	val := uint(dbuf[0])<<18 | uint(dbuf[1])<<12 | uint(dbuf[2])<<6 | uint(dbuf[3])
+	dbuf[2], dbuf[1], dbuf[0] = byte(val>>0), byte(val>>8), byte(val>>16)
+	switch dlen {
+	case 4:
+		dst[2] = dbuf[2]
+		dbuf[2] = 0
+		fallthrough
+	case 3:
+		dst[1] = dbuf[1]
+		if enc.strict && dbuf[2] != 0 {
+			return si, 0, nonCanonical(src, si-1)
+		}
+
+		dbuf[1] = 0
+		fallthrough
+	case 2:
+		dst[0] = dbuf[0]
+		if enc.strict && (dbuf[1] != 0 || dbuf[2] != 0) {
+			return si, 0, nonCanonical(src, si-2)
+		}
+	}
+
+	return si, dlen - 1, err
+}
+
+// skipIgnored returns the offset of the first byte at or after src[si]
+// that enc does not ignore.
+func (enc Encoding) skipIgnored(src []byte, si int) int {
+	for si < len(src) && enc.ignores(src[si]) {
+		si++
+	}
+
+	return si
+}
+
+func (enc Encoding) inAlphabet(c byte) bool {
+	return enc.decodeMap[c] != invalidIndex
+}
+
+func (enc Encoding) ignores(c byte) bool {
+	return strings.IndexByte(enc.ignore, c) >= 0
+}
+
+// A CorruptReason describes why a CorruptInputError was returned.
+type CorruptReason int
+
+const (
+	// InvalidCharacter is a byte that is neither in the alphabet
+	// nor the padding character.
+	InvalidCharacter CorruptReason = iota + 1
+
+	// InvalidPadding is padding that is misplaced or incomplete,
+	// or data that follows padding.
+	InvalidPadding
+
+	// Truncated is input that ends part way through a quantum.
+	Truncated
+
+	// NonCanonical is a final quantum with non-zero trailing bits,
+	// which is only rejected by strict encodings.
+	NonCanonical
+)
+
+var reasons = [...]string{
+	InvalidCharacter: "invalid character",
+	InvalidPadding:   "invalid padding",
+	Truncated:        "truncated input",
+	NonCanonical:     "non-zero trailing bits",
+}
+
+func (r CorruptReason) String() string {
+	if r > 0 && int(r) < len(reasons) {
+		return reasons[r]
+	}
+
+	return "CorruptReason(" + strconv.Itoa(int(r)) + ")"
+}
+
+// CorruptInputError is returned by Decode and DecodeString when the
+// input is not valid base64. errors.Is reports it as ErrFormat.
+type CorruptInputError struct {
+	Offset int64         // offset of the first invalid byte
+	Char   byte          // byte at Offset, or zero if Offset is the end of input
+	Reason CorruptReason // why the input was rejected
+}
+
+func (e CorruptInputError) Error() string {
+	return "go-base64: illegal base64 data at input byte " + strconv.FormatInt(e.Offset, 10) + ": " + e.Reason.String()
+}
+
+// Is reports whether target is ErrFormat.
+func (e CorruptInputError) Is(target error) bool {
+	return target == ErrFormat
+}
+
+// corruptInputError returns the error for input rejected at src[off]. The
+// reason is inferred from the byte at off and the byte before it, so it
+// must not be used for non-canonical input.
+func (enc Encoding) corruptInputError(src []byte, off int) CorruptInputError {
+	if off >= len(src) {
+		// not enough padding
+		return CorruptInputError{int64(off), 0, Truncated}
+	}
+
+	e := CorruptInputError{int64(off), src[off], Truncated}
+	switch {
+	case enc.isPadding(e.Char):
+		// misplaced padding
+		e.Reason = InvalidPadding
+	case !enc.inAlphabet(e.Char):
+		e.Reason = InvalidCharacter
+	case enc.followsPadding(src, off):
+		// trailing garbage
+		e.Reason = InvalidPadding
+	}
+
+	return e
+}
+
+// nonCanonical returns the error for a final quantum with non-zero
+// trailing bits that was rejected at src[off].
+func nonCanonical(src []byte, off int) CorruptInputError {
+	return CorruptInputError{int64(off), src[off], NonCanonical}
+}
+
+func (enc Encoding) isPadding(c byte) bool {
+	return enc.padding != NoPadding && rune(c) == enc.padding
+}
+
+// followsPadding reports whether the last byte before src[off], other
+// than those that enc ignores, is the padding character.
+func (enc Encoding) followsPadding(src []byte, off int) bool {
+	for off--; off >= 0; off-- {
+		if c := src[off]; !enc.ignores(c) {
+			return enc.isPadding(c)
+		}
+	}
+
+	return false
+}
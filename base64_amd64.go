@@ -3,108 +3,123 @@
 // Modified BSD License license that can be found in
 // the LICENSE file.
 
-// +build amd64,!gccgo,!appengine
+// +build amd64,!gccgo,!appengine,!purego
 
 package base64
 
-import "io"
+// asmChunk is the most input that is passed to the assembly at once. The
+// assembly cannot be preempted, so longer inputs are split into chunks
+// and each is passed from a function whose prologue checks whether the
+// goroutine should yield. This bounds how long a large call holds up a
+// stop-the-world pause or other goroutines. It must be a multiple of 4.
+var asmChunk = 64 * 1024
 
-import "fmt"
-import "strings"
-
-type Encoding struct {
-	url     bool
-	padding rune
+// encodeTo encodes src, which must not be empty, into dst.
+func (enc Encoding) encodeTo(dst, src []byte) {
+	encodeChunked(dst, src, enc.padding, enc.alphabet)
 }
 
-func newEncoding(encType encodingType) Encoding {
-	switch encType {
-	case encodeStd:
-		return Encoding{false, StdPadding}
-	case encodeURL:
-		return Encoding{true, StdPadding}
-	default:
-		panic("invalid encoding type")
+// encodeChunked, decodeChunked and validChunked take the tables rather
+// than enc, so that encodeTo, decode and valid are inlined and no copy of
+// enc is made. Input of up to asmChunk characters, which is most, is passed
+// straight to the assembly.
+func encodeChunked(dst, src []byte, padding rune, a *alphabet) {
+	// Only the last chunk may need padding.
+	chunk := asmChunk / 4 * 3
+
+	for len(src) > chunk {
+		encodeBlock(dst, src[:chunk], a)
+		dst, src = dst[chunk/3*4:], src[chunk:]
 	}
-}
 
-func (enc Encoding) WithPadding(padding rune) Encoding {
-	return Encoding{enc.url, padding}
+	encodeASM(&dst[0], &src[0], uint64(len(src)), padding, &a.encode)
 }
 
-// TODO: func (enc Encoding) Strict() Encoding {}
-
-func (enc Encoding) EncodeToString(src []byte) string {
-	buf := make([]byte, enc.EncodedLen(len(src)))
-	enc.Encode(buf, src)
-	return string(buf)
+// encodeBlock, decodeBlock and validBlock call the assembly for a chunk
+// before the last. They are not inlined so that there is a preemption
+// point between chunks.
+//
+//go:noinline
+func encodeBlock(dst, src []byte, a *alphabet) {
+	encodeASM(&dst[0], &src[0], uint64(len(src)), NoPadding, &a.encode)
 }
 
-func (enc Encoding) EncodedLen(n int) int {
-	if enc.padding == NoPadding {
-		return (n*8 + 5) / 6 // minimum # chars at 6 bits per char
-	}
-
-	return (n + 2) / 3 * 4 // minimum # 4-char quanta, 3 bytes each
+// decode decodes src into dst. If src contains an invalid character, the
+// quanta before it are decoded and its offset is returned with ok false.
+func (enc Encoding) decode(dst, src []byte) (n int, ok bool) {
+	return decodeChunked(dst, src, enc.alphabet)
 }
 
-func (enc Encoding) DecodeString(s string) ([]byte, error) {
-	dbuf := make([]byte, enc.DecodedLen(len(s)))
-	n, err := enc.Decode(dbuf, []byte(s))
-	return dbuf[:n], err
-}
+func decodeChunked(dst, src []byte, a *alphabet) (n int, ok bool) {
+	si := 0
+	for ; len(src)-si > asmChunk; si += asmChunk {
+		if nn, ok := decodeBlock(dst[si/4*3:], src[si:si+asmChunk], a); !ok {
+			return si + nn, false
+		}
+	}
 
-func (enc Encoding) DecodedLen(n int) int {
-	if enc.padding == NoPadding {
-		// Unpadded data may end with partial block of 2-3 characters.
-		return (n*6 + 7) / 8
+	nn, ok := decodeASM(&dst[si/4*3], &src[si], uint64(len(src)-si), &a.decodeMap, a.vector, a.translate)
+	if !ok {
+		return si + int(nn), false
 	}
 
-	// Padded base64 should always be a multiple of 4 characters in length.
-	return n / 4 * 3
+	return si/4*3 + int(nn), true
 }
 
-func NewDecoder(enc Encoding, r io.Reader) io.Reader {
-	panic("not implemented")
+//go:noinline
+func decodeBlock(dst, src []byte, a *alphabet) (n int, ok bool) {
+	nn, ok := decodeASM(&dst[0], &src[0], uint64(len(src)), &a.decodeMap, a.vector, a.translate)
+	return int(nn), ok
 }
 
-func NewEncoder(enc Encoding, w io.Writer) io.WriteCloser {
-	panic("not implemented")
+// valid reports whether every character of src is in the alphabet. If
+// not, the offset of the first that is not is returned with ok false.
+func (enc Encoding) valid(src []byte) (n int, ok bool) {
+	return validChunked(src, enc.alphabet)
 }
 
-func (enc Encoding) Encode(dst, src []byte) {
-	if len(src) == 0 {
-		return
+func validChunked(src []byte, a *alphabet) (n int, ok bool) {
+	for len(src)-n > asmChunk {
+		m := validBlock(src[n:n+asmChunk], a)
+		if n += m; m != asmChunk {
+			return validScalar(src, n, a)
+		}
 	}
 
-	encodeASM(&dst[0], &src[0], uint64(len(src)), enc.padding, enc.url)
-}
-
-func (enc Encoding) Decode(dst, src []byte) (n int, err error) {
-	if len(src) == 0 {
-		return
+	if n < len(src) {
+		n += int(validASM(&src[n], uint64(len(src)-n), a.vector, a.translate))
 	}
 
-	nn, ok := decodeASM(&dst[0], &src[0], uint64(len(dst)), enc.padding, enc.url)
-	if !ok {
-		err = ErrFormat
-	}
+	return validScalar(src, n, a)
+}
 
-	fmt.Println(" " + strings.Join(strings.Split(string(src), ""), " "))
-	fmt.Printf("%x\n", dst)
+// validScalar checks src[n:], which the assembly left, one character at
+// a time.
+func validScalar(src []byte, n int, a *alphabet) (int, bool) {
+	for ; n < len(src); n++ {
+		if a.decodeMap[src[n]] == invalidIndex {
+			return n, false
+		}
+	}
 
-	fmt.Println(nn, ok)
+	return n, true
+}
 
-	n = int(nn)
-	return
+//go:noinline
+func validBlock(src []byte, a *alphabet) int {
+	return int(validASM(&src[0], uint64(len(src)), a.vector, a.translate))
 }
 
 //go:generate go run asm_gen.go
 
 // This function is implemented in base64_encode_amd64.s
 //go:noescape
-func encodeASM(dst *byte, src *byte, len uint64, padding int32, url bool)
+func encodeASM(dst *byte, src *byte, len uint64, padding int32, lookup *[64]byte)
+
+// This function is implemented in base64_decode_amd64.s
+//go:noescape
+func decodeASM(dst *byte, src *byte, len uint64, lookup *[256]byte, vector *[80]byte, translate *[32]byte) (n uint64, ok bool)
 
 // This function is implemented in base64_decode_amd64.s
 //go:noescape
-func decodeASM(dst *byte, src *byte, len uint64, padding int32, url bool) (n uint64, ok bool)
+func validASM(src *byte, len uint64, vector *[80]byte, translate *[32]byte) (n uint64)
@@ -5,96 +5,686 @@
 //
 // This file is auto-generated - do not modify
 
-// +build amd64,!gccgo,!appengine
+// +build amd64,!gccgo,!appengine,!purego
 
 #include "textflag.h"
 
-DATA decodeLowerBound<>+0x00(SB)/8, $0x01012b3040506170
-DATA decodeLowerBound<>+0x08(SB)/8, $0x0101010101010101
-GLOBL decodeLowerBound<>(SB),RODATA,$16
-
-DATA decodeUpperBound<>+0x00(SB)/8, $0x00002b394f5a6f7a
-GLOBL decodeUpperBound<>(SB),RODATA,$16
-
-DATA decodeShifts<>+0x00(SB)/8, $0x00003e34000f1a29
-GLOBL decodeShifts<>(SB),RODATA,$16
-
 DATA decodeNibble<>+0x00(SB)/8, $0x0f0f0f0f0f0f0f0f
 DATA decodeNibble<>+0x08(SB)/8, $0x0f0f0f0f0f0f0f0f
 GLOBL decodeNibble<>(SB),RODATA,$16
 
-DATA decode2f<>+0x00(SB)/8, $0x2f2f2f2f2f2f2f2f
-DATA decode2f<>+0x08(SB)/8, $0x2f2f2f2f2f2f2f2f
-GLOBL decode2f<>(SB),RODATA,$16
-
-DATA decode2fOffset<>+0x00(SB)/8, $0xfdfdfdfdfdfdfdfd
-DATA decode2fOffset<>+0x08(SB)/8, $0xfdfdfdfdfdfdfdfd
-GLOBL decode2fOffset<>(SB),RODATA,$16
-
-DATA decodeMerge<>+0x00(SB)/4, $0x40014001
-DATA decodeMerge<>+0x04(SB)/4, $0x40014001
-DATA decodeMerge<>+0x08(SB)/4, $0x40014001
-DATA decodeMerge<>+0x0c(SB)/4, $0x40014001
-DATA decodeMerge<>+0x10(SB)/4, $0x10000001
-DATA decodeMerge<>+0x14(SB)/4, $0x10000001
-DATA decodeMerge<>+0x18(SB)/4, $0x10000001
-DATA decodeMerge<>+0x1c(SB)/4, $0x10000001
+DATA decodeMerge<>+0x00(SB)/4, $0x01400140
+DATA decodeMerge<>+0x04(SB)/4, $0x01400140
+DATA decodeMerge<>+0x08(SB)/4, $0x01400140
+DATA decodeMerge<>+0x0c(SB)/4, $0x01400140
+DATA decodeMerge<>+0x10(SB)/4, $0x00011000
+DATA decodeMerge<>+0x14(SB)/4, $0x00011000
+DATA decodeMerge<>+0x18(SB)/4, $0x00011000
+DATA decodeMerge<>+0x1c(SB)/4, $0x00011000
 GLOBL decodeMerge<>(SB),RODATA,$32
 
+DATA decodeShufOut<>+0x00(SB)/4, $0x06000102
+DATA decodeShufOut<>+0x04(SB)/4, $0x090a0405
+DATA decodeShufOut<>+0x08(SB)/4, $0x0c0d0e08
+DATA decodeShufOut<>+0x0c(SB)/4, $0xffffffff
+GLOBL decodeShufOut<>(SB),RODATA,$16
+
 TEXT ·decodeASM(SB),NOSPLIT,$0
 	MOVQ dst+0(FP), DI
 	MOVQ src+8(FP), SI
 	MOVQ len+16(FP), BX
-	MOVL padding+24(FP), DX
-	MOVB url+28(FP), AX
-	MOVQ SI, R14
-	MOVQ DI, R15
-	MOVW $65535, DX
+	MOVQ lookup+24(FP), DX
+	MOVQ vector+32(FP), R15
+	MOVQ SI, R8
+	MOVQ DI, R9
+	XORQ R10, R10
+	XORQ R11, R11
+	XORQ R12, R12
+	XORQ R13, R13
 	CMPQ BX, $24
 	JB loop
-	MOVQ $decodeMerge<>(SB), R15
-	MOVQ decodeLowerBound<>(SB), X13
-	MOVQ decodeUpperBound<>(SB), X14
-	MOVQ decodeShifts<>(SB), X15
+	TESTQ R15, R15
+	JZ loop
+	CMPB ·decodeLoop(SB), $2
+	JB loop
+	MOVOU (R15), X13
+	MOVOU 16(R15), X14
+	MOVOU 32(R15), X15
+	MOVOU 48(R15), X12
+	MOVOU 64(R15), X11
+	MOVOU decodeMerge<>(SB), X10
+	MOVOU decodeMerge<>+0x10(SB), X9
+	MOVQ translate+40(FP), CX
+	TESTQ CX, CX
+	JNZ bigloop_avx_translate_preheader
+	CMPQ BX, $40
+	JB bigloop_avx
+	CMPB ·decodeLoop(SB), $3
+	JAE bigloop_avx2_preheader
 bigloop_avx:
 	MOVOU (SI), X1
 	VPSRLD $4, X1, X2
 	PAND decodeNibble<>(SB), X2
 	VPSHUFB X2, X13, X3
-	VPSHUFB X2, X14, X0
-	// VPCMPGTB X1, X3, X4
-	BYTE $0xc5; BYTE $0xe1; BYTE $0x64; BYTE $0xe1
-	// VPCMPGTB X0, X1, X5
-	BYTE $0xc5; BYTE $0xf1; BYTE $0x64; BYTE $0xe8
-	VPCMPEQB decode2f<>(SB), X1, X6
-	POR X5, X4
-	PANDN X4, X6
-	PMOVMSKB X6, AX
-	VPSHUFB X2, X15, X7
-	PSUBB X0, X1
-	PADDB X7, X1
-	PAND decode2fOffset<>(SB), X6
-	PADDB X7, X1
-	// PMADDUBSW (R15), X1
-	BYTE $0x66; BYTE $0x41; BYTE $0x0f; BYTE $0x38; BYTE $0x04; BYTE $0x0f
-	PMADDWL 16(R15), X1
+	VPSHUFB X2, X14, X4
+	// VPCMPGTB X1, X3, X3
+	BYTE $0xc5; BYTE $0xe1; BYTE $0x64; BYTE $0xd9
+	// VPCMPGTB X4, X1, X4
+	BYTE $0xc5; BYTE $0xf1; BYTE $0x64; BYTE $0xe4
+	VPCMPEQB X12, X1, X5
+	POR X4, X3
+	VPANDN X3, X5, X4
+	PMOVMSKB X4, AX
+	TESTL AX, AX
+	JNZ loop
+	VPSHUFB X2, X15, X2
+	PAND X11, X5
+	PADDB X2, X1
+	PADDB X5, X1
+	// PMADDUBSW X10, X1
+	BYTE $0x66; BYTE $0x41; BYTE $0x0f; BYTE $0x38; BYTE $0x04; BYTE $0xca
+	PMADDWL X9, X1
+	PSHUFB decodeShufOut<>(SB), X1
 	MOVOU X1, (DI)
 	SUBQ $16, BX
-	JZ ret
 	ADDQ $16, SI
 	ADDQ $12, DI
+	CMPQ BX, $24
+	JAE bigloop_avx
 loop:
-	XORQ AX, AX
-	JMP invalid
+	CMPQ BX, $4
+	JB tail
+	MOVB (SI), R10
+	MOVB (DX)(R10*1), R10
+	MOVL $1, AX
+	CMPB R10, $255
+	JE invalid
+	MOVB 1(SI), R11
+	MOVB (DX)(R11*1), R11
+	MOVL $2, AX
+	CMPB R11, $255
+	JE invalid
+	MOVB 2(SI), R12
+	MOVB (DX)(R12*1), R12
+	MOVL $4, AX
+	CMPB R12, $255
+	JE invalid
+	MOVB 3(SI), R13
+	MOVB (DX)(R13*1), R13
+	MOVL $8, AX
+	CMPB R13, $255
+	JE invalid
+	SHLB $2, R10
+	MOVB R11, R14
+	SHRB $4, R14
+	ORB R14, R10
+	SHLB $4, R11
+	MOVB R12, R14
+	SHRB $2, R14
+	ORB R14, R11
+	SHLB $6, R12
+	ORB R13, R12
+	MOVB R10, (DI)
+	MOVB R11, 1(DI)
+	MOVB R12, 2(DI)
+	SUBQ $4, BX
+	ADDQ $4, SI
+	ADDQ $3, DI
+	JMP loop
+tail:
+	TESTQ BX, BX
+	JZ ret
+	MOVL $1, AX
+	CMPQ BX, $2
+	JB invalid
+	MOVB (SI), R10
+	MOVB (DX)(R10*1), R10
+	MOVL $1, AX
+	CMPB R10, $255
+	JE invalid
+	MOVB 1(SI), R11
+	MOVB (DX)(R11*1), R11
+	MOVL $2, AX
+	CMPB R11, $255
+	JE invalid
+	CMPQ BX, $3
+	JB tail_1
+	MOVB 2(SI), R12
+	MOVB (DX)(R12*1), R12
+	MOVL $4, AX
+	CMPB R12, $255
+	JE invalid
+	MOVB R11, R14
+	SHLB $4, R14
+	SHRB $2, R12
+	ORB R12, R14
+	MOVB R14, 1(DI)
+tail_1:
+	SHLB $2, R10
+	SHRB $4, R11
+	ORB R11, R10
+	MOVB R10, (DI)
+	LEAQ -1(DI)(BX*1), DI
 ret:
-	SUBQ R15, DI
-	MOVQ DI, n+32(FP)
-	MOVB $1, ok+40(FP)
+	SUBQ R9, DI
+	MOVQ DI, n+48(FP)
+	MOVB $1, ok+56(FP)
 	RET
 invalid:
-	BSFW AX, AX
-	SUBQ R14, SI
+	BSFL AX, AX
+	SUBQ R8, SI
 	ADDQ SI, AX
-	MOVQ AX, n+32(FP)
-	MOVB $0, ok+40(FP)
+	MOVQ AX, n+48(FP)
+	MOVB $0, ok+56(FP)
+	RET
+bigloop_avx2_preheader:
+	// VBROADCASTI128 (R15), Y13
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x2f
+	// VBROADCASTI128 16(R15), Y14
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x77; BYTE $0x10
+	// VBROADCASTI128 32(R15), Y15
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x7f; BYTE $0x20
+	// VBROADCASTI128 48(R15), Y12
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x67; BYTE $0x30
+	// VBROADCASTI128 64(R15), Y11
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x5f; BYTE $0x40
+	LEAQ decodeNibble<>(SB), R14
+	// VBROADCASTI128 (R14), Y8
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x06
+	LEAQ decodeMerge<>(SB), R14
+	// VBROADCASTI128 (R14), Y10
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x16
+	// VBROADCASTI128 16(R14), Y9
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x4e; BYTE $0x10
+	LEAQ decodeShufOut<>(SB), R14
+	// VBROADCASTI128 (R14), Y7
+	BYTE $0xc4; BYTE $0xc2; BYTE $0x7d; BYTE $0x5a; BYTE $0x3e
+bigloop_avx2:
+	VMOVDQU (SI), Y1
+	VPSRLD $4, Y1, Y2
+	VPAND Y8, Y2, Y2
+	VPSHUFB Y2, Y13, Y3
+	VPSHUFB Y2, Y14, Y4
+	// VPCMPGTB Y1, Y3, Y3
+	BYTE $0xc5; BYTE $0xe5; BYTE $0x64; BYTE $0xd9
+	// VPCMPGTB Y4, Y1, Y4
+	BYTE $0xc5; BYTE $0xf5; BYTE $0x64; BYTE $0xe4
+	VPCMPEQB Y12, Y1, Y5
+	VPOR Y4, Y3, Y3
+	VPANDN Y3, Y5, Y4
+	VPMOVMSKB Y4, AX
+	VPSHUFB Y2, Y15, Y2
+	VPAND Y11, Y5, Y5
+	// VPADDB Y2, Y1, Y1
+	BYTE $0xc5; BYTE $0xf5; BYTE $0xfc; BYTE $0xca
+	// VPADDB Y5, Y1, Y1
+	BYTE $0xc5; BYTE $0xf5; BYTE $0xfc; BYTE $0xcd
+	// VPMADDUBSW Y10, Y1, Y1
+	BYTE $0xc4; BYTE $0xc2; BYTE $0x75; BYTE $0x04; BYTE $0xca
+	// VPMADDWD Y9, Y1, Y1
+	BYTE $0xc4; BYTE $0xc1; BYTE $0x75; BYTE $0xf5; BYTE $0xc9
+	VPSHUFB Y7, Y1, Y1
+	VMOVDQU X1, (DI)
+	// VEXTRACTI128 $1, Y1, 12(DI)
+	BYTE $0xc4; BYTE $0xe3; BYTE $0x7d; BYTE $0x39; BYTE $0x4f; BYTE $0x0c; BYTE $0x01
+	TESTL AX, AX
+	JNZ bigloop_avx2_invalid
+	SUBQ $32, BX
+	ADDQ $32, SI
+	ADDQ $24, DI
+	CMPQ BX, $40
+	JAE bigloop_avx2
+	VZEROUPPER
+	CMPQ BX, $24
+	JAE bigloop_avx
+	JMP loop
+bigloop_avx_translate_preheader:
+	MOVOU (CX), X0
+	MOVOU 16(CX), X6
+	CMPQ BX, $40
+	JB bigloop_avx_translate
+	CMPB ·decodeLoop(SB), $3
+	JAE bigloop_avx2_translate_preheader
+bigloop_avx_translate:
+	MOVOU (SI), X1
+	VPSRLD $4, X1, X2
+	PAND decodeNibble<>(SB), X2
+	VPSHUFB X2, X0, X3
+	VPSHUFB X2, X6, X4
+	VPCMPEQB X1, X3, X3
+	PAND X4, X3
+	PADDB X3, X1
+	VPSRLD $4, X1, X2
+	PAND decodeNibble<>(SB), X2
+	VPSHUFB X2, X13, X3
+	VPSHUFB X2, X14, X4
+	// VPCMPGTB X1, X3, X3
+	BYTE $0xc5; BYTE $0xe1; BYTE $0x64; BYTE $0xd9
+	// VPCMPGTB X4, X1, X4
+	BYTE $0xc5; BYTE $0xf1; BYTE $0x64; BYTE $0xe4
+	VPCMPEQB X12, X1, X5
+	POR X4, X3
+	VPANDN X3, X5, X4
+	PMOVMSKB X4, AX
+	TESTL AX, AX
+	JNZ loop
+	VPSHUFB X2, X15, X2
+	PAND X11, X5
+	PADDB X2, X1
+	PADDB X5, X1
+	// PMADDUBSW X10, X1
+	BYTE $0x66; BYTE $0x41; BYTE $0x0f; BYTE $0x38; BYTE $0x04; BYTE $0xca
+	PMADDWL X9, X1
+	PSHUFB decodeShufOut<>(SB), X1
+	MOVOU X1, (DI)
+	SUBQ $16, BX
+	ADDQ $16, SI
+	ADDQ $12, DI
+	CMPQ BX, $24
+	JAE bigloop_avx_translate
+	JMP loop
+bigloop_avx2_translate_preheader:
+	// VBROADCASTI128 (R15), Y13
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x2f
+	// VBROADCASTI128 16(R15), Y14
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x77; BYTE $0x10
+	// VBROADCASTI128 32(R15), Y15
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x7f; BYTE $0x20
+	// VBROADCASTI128 48(R15), Y12
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x67; BYTE $0x30
+	// VBROADCASTI128 64(R15), Y11
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x5f; BYTE $0x40
+	LEAQ decodeNibble<>(SB), R14
+	// VBROADCASTI128 (R14), Y8
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x06
+	LEAQ decodeMerge<>(SB), R14
+	// VBROADCASTI128 (R14), Y10
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x16
+	// VBROADCASTI128 16(R14), Y9
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x4e; BYTE $0x10
+	LEAQ decodeShufOut<>(SB), R14
+	// VBROADCASTI128 (R14), Y7
+	BYTE $0xc4; BYTE $0xc2; BYTE $0x7d; BYTE $0x5a; BYTE $0x3e
+	// VBROADCASTI128 (CX), Y0
+	BYTE $0xc4; BYTE $0xe2; BYTE $0x7d; BYTE $0x5a; BYTE $0x01
+	// VBROADCASTI128 16(CX), Y6
+	BYTE $0xc4; BYTE $0xe2; BYTE $0x7d; BYTE $0x5a; BYTE $0x71; BYTE $0x10
+bigloop_avx2_translate:
+	VMOVDQU (SI), Y1
+	VPSRLD $4, Y1, Y2
+	VPAND Y8, Y2, Y2
+	VPSHUFB Y2, Y0, Y3
+	VPSHUFB Y2, Y6, Y4
+	VPCMPEQB Y1, Y3, Y3
+	VPAND Y4, Y3, Y3
+	// VPADDB Y3, Y1, Y1
+	BYTE $0xc5; BYTE $0xf5; BYTE $0xfc; BYTE $0xcb
+	VPSRLD $4, Y1, Y2
+	VPAND Y8, Y2, Y2
+	VPSHUFB Y2, Y13, Y3
+	VPSHUFB Y2, Y14, Y4
+	// VPCMPGTB Y1, Y3, Y3
+	BYTE $0xc5; BYTE $0xe5; BYTE $0x64; BYTE $0xd9
+	// VPCMPGTB Y4, Y1, Y4
+	BYTE $0xc5; BYTE $0xf5; BYTE $0x64; BYTE $0xe4
+	VPCMPEQB Y12, Y1, Y5
+	VPOR Y4, Y3, Y3
+	VPANDN Y3, Y5, Y4
+	VPMOVMSKB Y4, AX
+	VPSHUFB Y2, Y15, Y2
+	VPAND Y11, Y5, Y5
+	// VPADDB Y2, Y1, Y1
+	BYTE $0xc5; BYTE $0xf5; BYTE $0xfc; BYTE $0xca
+	// VPADDB Y5, Y1, Y1
+	BYTE $0xc5; BYTE $0xf5; BYTE $0xfc; BYTE $0xcd
+	// VPMADDUBSW Y10, Y1, Y1
+	BYTE $0xc4; BYTE $0xc2; BYTE $0x75; BYTE $0x04; BYTE $0xca
+	// VPMADDWD Y9, Y1, Y1
+	BYTE $0xc4; BYTE $0xc1; BYTE $0x75; BYTE $0xf5; BYTE $0xc9
+	VPSHUFB Y7, Y1, Y1
+	VMOVDQU X1, (DI)
+	// VEXTRACTI128 $1, Y1, 12(DI)
+	BYTE $0xc4; BYTE $0xe3; BYTE $0x7d; BYTE $0x39; BYTE $0x4f; BYTE $0x0c; BYTE $0x01
+	TESTL AX, AX
+	JNZ bigloop_avx2_invalid
+	SUBQ $32, BX
+	ADDQ $32, SI
+	ADDQ $24, DI
+	CMPQ BX, $40
+	JAE bigloop_avx2_translate
+	VZEROUPPER
+	CMPQ BX, $24
+	JAE bigloop_avx_translate
+	JMP loop
+bigloop_avx2_invalid:
+	VZEROUPPER
+	JMP invalid
+
+TEXT ·validASM(SB),NOSPLIT,$0
+	MOVQ src+0(FP), SI
+	MOVQ len+8(FP), BX
+	MOVQ vector+16(FP), R15
+	MOVQ translate+24(FP), CX
+	MOVQ SI, R8
+	CMPQ BX, $16
+	JB ret
+	TESTQ R15, R15
+	JZ ret
+	CMPB ·decodeLoop(SB), $2
+	JB ret
+	TESTQ CX, CX
+	JNZ translate
+	CMPQ BX, $32
+	JB bigloop_avx_preheader
+	CMPB ·decodeLoop(SB), $3
+	JAE bigloop_avx2_preheader
+bigloop_avx_preheader:
+	MOVOU (R15), X13
+	MOVOU 16(R15), X14
+	MOVOU 48(R15), X12
+bigloop_avx:
+	MOVOU (SI), X1
+	VPSRLD $4, X1, X2
+	PAND decodeNibble<>(SB), X2
+	VPSHUFB X2, X13, X3
+	VPSHUFB X2, X14, X4
+	// VPCMPGTB X1, X3, X3
+	BYTE $0xc5; BYTE $0xe1; BYTE $0x64; BYTE $0xd9
+	// VPCMPGTB X4, X1, X4
+	BYTE $0xc5; BYTE $0xf1; BYTE $0x64; BYTE $0xe4
+	VPCMPEQB X12, X1, X5
+	POR X4, X3
+	VPANDN X3, X5, X4
+	PMOVMSKB X4, AX
+	TESTL AX, AX
+	JNZ ret
+	SUBQ $16, BX
+	ADDQ $16, SI
+	CMPQ BX, $16
+	JAE bigloop_avx
+	JMP ret
+bigloop_avx2_preheader:
+	// VBROADCASTI128 (R15), Y13
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x2f
+	// VBROADCASTI128 16(R15), Y14
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x77; BYTE $0x10
+	// VBROADCASTI128 48(R15), Y12
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x67; BYTE $0x30
+	LEAQ decodeNibble<>(SB), R14
+	// VBROADCASTI128 (R14), Y8
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x06
+	CMPQ BX, $128
+	JB bigloop_avx2
+bigloop_avx2_unrolled:
+	VMOVDQU (SI), Y1
+	VPSRLD $4, Y1, Y2
+	VPAND Y8, Y2, Y2
+	VPSHUFB Y2, Y13, Y3
+	VPSHUFB Y2, Y14, Y4
+	// VPCMPGTB Y1, Y3, Y3
+	BYTE $0xc5; BYTE $0xe5; BYTE $0x64; BYTE $0xd9
+	// VPCMPGTB Y4, Y1, Y4
+	BYTE $0xc5; BYTE $0xf5; BYTE $0x64; BYTE $0xe4
+	VPCMPEQB Y12, Y1, Y5
+	VPOR Y4, Y3, Y3
+	VPANDN Y3, Y5, Y7
+	VMOVDQU 32(SI), Y1
+	VPSRLD $4, Y1, Y2
+	VPAND Y8, Y2, Y2
+	VPSHUFB Y2, Y13, Y3
+	VPSHUFB Y2, Y14, Y4
+	// VPCMPGTB Y1, Y3, Y3
+	BYTE $0xc5; BYTE $0xe5; BYTE $0x64; BYTE $0xd9
+	// VPCMPGTB Y4, Y1, Y4
+	BYTE $0xc5; BYTE $0xf5; BYTE $0x64; BYTE $0xe4
+	VPCMPEQB Y12, Y1, Y5
+	VPOR Y4, Y3, Y3
+	VPANDN Y3, Y5, Y4
+	VPOR Y4, Y7, Y7
+	VMOVDQU 64(SI), Y1
+	VPSRLD $4, Y1, Y2
+	VPAND Y8, Y2, Y2
+	VPSHUFB Y2, Y13, Y3
+	VPSHUFB Y2, Y14, Y4
+	// VPCMPGTB Y1, Y3, Y3
+	BYTE $0xc5; BYTE $0xe5; BYTE $0x64; BYTE $0xd9
+	// VPCMPGTB Y4, Y1, Y4
+	BYTE $0xc5; BYTE $0xf5; BYTE $0x64; BYTE $0xe4
+	VPCMPEQB Y12, Y1, Y5
+	VPOR Y4, Y3, Y3
+	VPANDN Y3, Y5, Y4
+	VPOR Y4, Y7, Y7
+	VMOVDQU 96(SI), Y1
+	VPSRLD $4, Y1, Y2
+	VPAND Y8, Y2, Y2
+	VPSHUFB Y2, Y13, Y3
+	VPSHUFB Y2, Y14, Y4
+	// VPCMPGTB Y1, Y3, Y3
+	BYTE $0xc5; BYTE $0xe5; BYTE $0x64; BYTE $0xd9
+	// VPCMPGTB Y4, Y1, Y4
+	BYTE $0xc5; BYTE $0xf5; BYTE $0x64; BYTE $0xe4
+	VPCMPEQB Y12, Y1, Y5
+	VPOR Y4, Y3, Y3
+	VPANDN Y3, Y5, Y4
+	VPOR Y4, Y7, Y7
+	VPMOVMSKB Y7, AX
+	TESTL AX, AX
+	JNZ bigloop_avx2
+	SUBQ $128, BX
+	ADDQ $128, SI
+	CMPQ BX, $128
+	JAE bigloop_avx2_unrolled
+	CMPQ BX, $32
+	JB bigloop_avx2_tail
+bigloop_avx2:
+	VMOVDQU (SI), Y1
+	VPSRLD $4, Y1, Y2
+	VPAND Y8, Y2, Y2
+	VPSHUFB Y2, Y13, Y3
+	VPSHUFB Y2, Y14, Y4
+	// VPCMPGTB Y1, Y3, Y3
+	BYTE $0xc5; BYTE $0xe5; BYTE $0x64; BYTE $0xd9
+	// VPCMPGTB Y4, Y1, Y4
+	BYTE $0xc5; BYTE $0xf5; BYTE $0x64; BYTE $0xe4
+	VPCMPEQB Y12, Y1, Y5
+	VPOR Y4, Y3, Y3
+	VPANDN Y3, Y5, Y4
+	VPMOVMSKB Y4, AX
+	TESTL AX, AX
+	JNZ bigloop_avx2_invalid
+	SUBQ $32, BX
+	ADDQ $32, SI
+	CMPQ BX, $32
+	JAE bigloop_avx2
+bigloop_avx2_tail:
+	VZEROUPPER
+	CMPQ BX, $16
+	JAE bigloop_avx
+	JMP ret
+translate:
+	CMPQ BX, $32
+	JB bigloop_avx_translate_preheader
+	CMPB ·decodeLoop(SB), $3
+	JAE bigloop_avx2_translate_preheader
+bigloop_avx_translate_preheader:
+	MOVOU (R15), X13
+	MOVOU 16(R15), X14
+	MOVOU 48(R15), X12
+	MOVOU (CX), X0
+	MOVOU 16(CX), X6
+bigloop_avx_translate:
+	MOVOU (SI), X1
+	VPSRLD $4, X1, X2
+	PAND decodeNibble<>(SB), X2
+	VPSHUFB X2, X0, X3
+	VPSHUFB X2, X6, X4
+	VPCMPEQB X1, X3, X3
+	PAND X4, X3
+	PADDB X3, X1
+	VPSRLD $4, X1, X2
+	PAND decodeNibble<>(SB), X2
+	VPSHUFB X2, X13, X3
+	VPSHUFB X2, X14, X4
+	// VPCMPGTB X1, X3, X3
+	BYTE $0xc5; BYTE $0xe1; BYTE $0x64; BYTE $0xd9
+	// VPCMPGTB X4, X1, X4
+	BYTE $0xc5; BYTE $0xf1; BYTE $0x64; BYTE $0xe4
+	VPCMPEQB X12, X1, X5
+	POR X4, X3
+	VPANDN X3, X5, X4
+	PMOVMSKB X4, AX
+	TESTL AX, AX
+	JNZ ret
+	SUBQ $16, BX
+	ADDQ $16, SI
+	CMPQ BX, $16
+	JAE bigloop_avx_translate
+	JMP ret
+bigloop_avx2_translate_preheader:
+	// VBROADCASTI128 (R15), Y13
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x2f
+	// VBROADCASTI128 16(R15), Y14
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x77; BYTE $0x10
+	// VBROADCASTI128 48(R15), Y12
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x67; BYTE $0x30
+	LEAQ decodeNibble<>(SB), R14
+	// VBROADCASTI128 (R14), Y8
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x06
+	// VBROADCASTI128 (CX), Y0
+	BYTE $0xc4; BYTE $0xe2; BYTE $0x7d; BYTE $0x5a; BYTE $0x01
+	// VBROADCASTI128 16(CX), Y6
+	BYTE $0xc4; BYTE $0xe2; BYTE $0x7d; BYTE $0x5a; BYTE $0x71; BYTE $0x10
+	CMPQ BX, $128
+	JB bigloop_avx2_translate
+bigloop_avx2_translate_unrolled:
+	VMOVDQU (SI), Y1
+	VPSRLD $4, Y1, Y2
+	VPAND Y8, Y2, Y2
+	VPSHUFB Y2, Y0, Y3
+	VPSHUFB Y2, Y6, Y4
+	VPCMPEQB Y1, Y3, Y3
+	VPAND Y4, Y3, Y3
+	// VPADDB Y3, Y1, Y1
+	BYTE $0xc5; BYTE $0xf5; BYTE $0xfc; BYTE $0xcb
+	VPSRLD $4, Y1, Y2
+	VPAND Y8, Y2, Y2
+	VPSHUFB Y2, Y13, Y3
+	VPSHUFB Y2, Y14, Y4
+	// VPCMPGTB Y1, Y3, Y3
+	BYTE $0xc5; BYTE $0xe5; BYTE $0x64; BYTE $0xd9
+	// VPCMPGTB Y4, Y1, Y4
+	BYTE $0xc5; BYTE $0xf5; BYTE $0x64; BYTE $0xe4
+	VPCMPEQB Y12, Y1, Y5
+	VPOR Y4, Y3, Y3
+	VPANDN Y3, Y5, Y7
+	VMOVDQU 32(SI), Y1
+	VPSRLD $4, Y1, Y2
+	VPAND Y8, Y2, Y2
+	VPSHUFB Y2, Y0, Y3
+	VPSHUFB Y2, Y6, Y4
+	VPCMPEQB Y1, Y3, Y3
+	VPAND Y4, Y3, Y3
+	// VPADDB Y3, Y1, Y1
+	BYTE $0xc5; BYTE $0xf5; BYTE $0xfc; BYTE $0xcb
+	VPSRLD $4, Y1, Y2
+	VPAND Y8, Y2, Y2
+	VPSHUFB Y2, Y13, Y3
+	VPSHUFB Y2, Y14, Y4
+	// VPCMPGTB Y1, Y3, Y3
+	BYTE $0xc5; BYTE $0xe5; BYTE $0x64; BYTE $0xd9
+	// VPCMPGTB Y4, Y1, Y4
+	BYTE $0xc5; BYTE $0xf5; BYTE $0x64; BYTE $0xe4
+	VPCMPEQB Y12, Y1, Y5
+	VPOR Y4, Y3, Y3
+	VPANDN Y3, Y5, Y4
+	VPOR Y4, Y7, Y7
+	VMOVDQU 64(SI), Y1
+	VPSRLD $4, Y1, Y2
+	VPAND Y8, Y2, Y2
+	VPSHUFB Y2, Y0, Y3
+	VPSHUFB Y2, Y6, Y4
+	VPCMPEQB Y1, Y3, Y3
+	VPAND Y4, Y3, Y3
+	// VPADDB Y3, Y1, Y1
+	BYTE $0xc5; BYTE $0xf5; BYTE $0xfc; BYTE $0xcb
+	VPSRLD $4, Y1, Y2
+	VPAND Y8, Y2, Y2
+	VPSHUFB Y2, Y13, Y3
+	VPSHUFB Y2, Y14, Y4
+	// VPCMPGTB Y1, Y3, Y3
+	BYTE $0xc5; BYTE $0xe5; BYTE $0x64; BYTE $0xd9
+	// VPCMPGTB Y4, Y1, Y4
+	BYTE $0xc5; BYTE $0xf5; BYTE $0x64; BYTE $0xe4
+	VPCMPEQB Y12, Y1, Y5
+	VPOR Y4, Y3, Y3
+	VPANDN Y3, Y5, Y4
+	VPOR Y4, Y7, Y7
+	VMOVDQU 96(SI), Y1
+	VPSRLD $4, Y1, Y2
+	VPAND Y8, Y2, Y2
+	VPSHUFB Y2, Y0, Y3
+	VPSHUFB Y2, Y6, Y4
+	VPCMPEQB Y1, Y3, Y3
+	VPAND Y4, Y3, Y3
+	// VPADDB Y3, Y1, Y1
+	BYTE $0xc5; BYTE $0xf5; BYTE $0xfc; BYTE $0xcb
+	VPSRLD $4, Y1, Y2
+	VPAND Y8, Y2, Y2
+	VPSHUFB Y2, Y13, Y3
+	VPSHUFB Y2, Y14, Y4
+	// VPCMPGTB Y1, Y3, Y3
+	BYTE $0xc5; BYTE $0xe5; BYTE $0x64; BYTE $0xd9
+	// VPCMPGTB Y4, Y1, Y4
+	BYTE $0xc5; BYTE $0xf5; BYTE $0x64; BYTE $0xe4
+	VPCMPEQB Y12, Y1, Y5
+	VPOR Y4, Y3, Y3
+	VPANDN Y3, Y5, Y4
+	VPOR Y4, Y7, Y7
+	VPMOVMSKB Y7, AX
+	TESTL AX, AX
+	JNZ bigloop_avx2_translate
+	SUBQ $128, BX
+	ADDQ $128, SI
+	CMPQ BX, $128
+	JAE bigloop_avx2_translate_unrolled
+	CMPQ BX, $32
+	JB bigloop_avx2_translate_tail
+bigloop_avx2_translate:
+	VMOVDQU (SI), Y1
+	VPSRLD $4, Y1, Y2
+	VPAND Y8, Y2, Y2
+	VPSHUFB Y2, Y0, Y3
+	VPSHUFB Y2, Y6, Y4
+	VPCMPEQB Y1, Y3, Y3
+	VPAND Y4, Y3, Y3
+	// VPADDB Y3, Y1, Y1
+	BYTE $0xc5; BYTE $0xf5; BYTE $0xfc; BYTE $0xcb
+	VPSRLD $4, Y1, Y2
+	VPAND Y8, Y2, Y2
+	VPSHUFB Y2, Y13, Y3
+	VPSHUFB Y2, Y14, Y4
+	// VPCMPGTB Y1, Y3, Y3
+	BYTE $0xc5; BYTE $0xe5; BYTE $0x64; BYTE $0xd9
+	// VPCMPGTB Y4, Y1, Y4
+	BYTE $0xc5; BYTE $0xf5; BYTE $0x64; BYTE $0xe4
+	VPCMPEQB Y12, Y1, Y5
+	VPOR Y4, Y3, Y3
+	VPANDN Y3, Y5, Y4
+	VPMOVMSKB Y4, AX
+	TESTL AX, AX
+	JNZ bigloop_avx2_invalid
+	SUBQ $32, BX
+	ADDQ $32, SI
+	CMPQ BX, $32
+	JAE bigloop_avx2_translate
+bigloop_avx2_translate_tail:
+	VZEROUPPER
+	CMPQ BX, $16
+	JAE bigloop_avx_translate
+	JMP ret
+bigloop_avx2_invalid:
+	VZEROUPPER
+ret:
+	SUBQ R8, SI
+	MOVQ SI, n+32(FP)
 	RET
@@ -10,7 +10,7 @@
 //
 // This file is auto-generated - do not modify
 
-// +build amd64,!gccgo,!appengine
+// +build amd64,!gccgo,!appengine,!purego
 
 #include "textflag.h"
 
@@ -36,74 +36,36 @@ DATA encodeAnd<>+0x30(SB)/8, $0x3f003f003f003f00
 DATA encodeAnd<>+0x38(SB)/8, $0x3f003f003f003f00
 GLOBL encodeAnd<>(SB),RODATA,$64
 
-DATA encodeCompare<>+0x00(SB)/8, $0x1919191919191919
-DATA encodeCompare<>+0x08(SB)/8, $0x1919191919191919
-DATA encodeCompare<>+0x10(SB)/8, $0x3333333333333333
-DATA encodeCompare<>+0x18(SB)/8, $0x3333333333333333
-DATA encodeCompare<>+0x20(SB)/8, $0x3e3e3e3e3e3e3e3e
-DATA encodeCompare<>+0x28(SB)/8, $0x3e3e3e3e3e3e3e3e
-DATA encodeCompare<>+0x30(SB)/8, $0x3f3f3f3f3f3f3f3f
-DATA encodeCompare<>+0x38(SB)/8, $0x3f3f3f3f3f3f3f3f
-GLOBL encodeCompare<>(SB),RODATA,$64
-
-DATA encodeBase<>+0x00(SB)/8, $0x4141414141414141
-DATA encodeBase<>+0x08(SB)/8, $0x4141414141414141
-DATA encodeBase<>+0x10(SB)/8, $0x4747474747474747
-DATA encodeBase<>+0x18(SB)/8, $0x4747474747474747
-DATA encodeBase<>+0x20(SB)/8, $0xfcfcfcfcfcfcfcfc
-DATA encodeBase<>+0x28(SB)/8, $0xfcfcfcfcfcfcfcfc
-DATA encodeBase<>+0x30(SB)/8, $0x2b2b2b2b2b2b2b2b
-DATA encodeBase<>+0x38(SB)/8, $0x2b2b2b2b2b2b2b2b
-DATA encodeBase<>+0x40(SB)/8, $0x2f2f2f2f2f2f2f2f
-DATA encodeBase<>+0x48(SB)/8, $0x2f2f2f2f2f2f2f2f
-DATA encodeBase<>+0x50(SB)/8, $0x2d2d2d2d2d2d2d2d
-DATA encodeBase<>+0x58(SB)/8, $0x2d2d2d2d2d2d2d2d
-DATA encodeBase<>+0x60(SB)/8, $0x5f5f5f5f5f5f5f5f
-DATA encodeBase<>+0x68(SB)/8, $0x5f5f5f5f5f5f5f5f
-GLOBL encodeBase<>(SB),RODATA,$112
-
-DATA encodeLookup<>+0x00(SB)/8, $"ABCDEFGH"
-DATA encodeLookup<>+0x08(SB)/8, $"IJKLMNOP"
-DATA encodeLookup<>+0x10(SB)/8, $"QRSTUVWX"
-DATA encodeLookup<>+0x18(SB)/8, $"YZabcdef"
-DATA encodeLookup<>+0x20(SB)/8, $"ghijklmn"
-DATA encodeLookup<>+0x28(SB)/8, $"opqrstuv"
-DATA encodeLookup<>+0x30(SB)/8, $"wxyz0123"
-DATA encodeLookup<>+0x38(SB)/8, $"456789+/"
-DATA encodeLookup<>+0x40(SB)/8, $"ABCDEFGH"
-DATA encodeLookup<>+0x48(SB)/8, $"IJKLMNOP"
-DATA encodeLookup<>+0x50(SB)/8, $"QRSTUVWX"
-DATA encodeLookup<>+0x58(SB)/8, $"YZabcdef"
-DATA encodeLookup<>+0x60(SB)/8, $"ghijklmn"
-DATA encodeLookup<>+0x68(SB)/8, $"opqrstuv"
-DATA encodeLookup<>+0x70(SB)/8, $"wxyz0123"
-DATA encodeLookup<>+0x78(SB)/8, $"456789-_"
-GLOBL encodeLookup<>(SB),RODATA,$128
+DATA encodeLookup<>+0x00(SB)/8, $0x7070707070707070
+DATA encodeLookup<>+0x08(SB)/8, $0x7070707070707070
+DATA encodeLookup<>+0x10(SB)/8, $0x1010101010101010
+DATA encodeLookup<>+0x18(SB)/8, $0x1010101010101010
+GLOBL encodeLookup<>(SB),RODATA,$32
 
 TEXT ·encodeASM(SB),NOSPLIT,$0
 	MOVQ dst+0(FP), DI
 	MOVQ src+8(FP), SI
 	MOVQ len+16(FP), BX
 	MOVL padding+24(FP), AX
-	XORQ R14, R14
-	MOVB url+28(FP), R14
-	SHLQ $3, R14
-	MOVQ $encodeLookup<>(SB), DX
-	LEAQ (DX)(R14*8), DX
+	MOVQ lookup+32(FP), DX
 	CMPQ BX, $3
 	JB tail
 	CMPQ BX, $16
 	JB loop_preheader
-	SHRQ $1, R14
-	MOVOU encodeBase<>(SB), X11
-	MOVOU encodeBase<>+0x10(SB), X12
-	MOVOU encodeBase<>+0x20(SB), X13
-	MOVQ $encodeBase<>(SB), R13
-	MOVOU 48(R13)(R14*8), X14
-	MOVOU 64(R13)(R14*8), X15
-	MOVQ $encodeCompare<>(SB), R14
-	CMPB runtime·support_avx(SB), $1
-	JNE bigloop_sse
+	CMPB ·encodeLoop(SB), $1
+	JB loop_preheader
+	MOVOU (DX), X8
+	MOVOU 16(DX), X9
+	MOVOU 32(DX), X10
+	MOVOU 48(DX), X11
+	MOVOU encodeLookup<>(SB), X12
+	MOVOU encodeLookup<>+0x10(SB), X13
+	CMPB ·encodeLoop(SB), $2
+	JB bigloop_sse
+	CMPQ BX, $28
+	JB bigloop_avx
+	CMPB ·encodeLoop(SB), $3
+	JAE bigloop_avx2_preheader
 bigloop_avx:
 	MOVOU (SI), X1
 	PSHUFB encodeShuf<>(SB), X1
@@ -116,21 +78,24 @@ bigloop_avx:
 	PAND encodeAnd<>+0x30(SB), X1
 	POR X0, X1
 	PSHUFB encodeShufOut<>(SB), X1
-	// VPCMPGTB (R14), X1, X2
-	BYTE $0xc4; BYTE $0xc1; BYTE $0x71; BYTE $0x64; BYTE $0x16
-	// VPCMPGTB 16(R14), X1, X3
-	BYTE $0xc4; BYTE $0xc1; BYTE $0x71; BYTE $0x64; BYTE $0x5e; BYTE $0x10
-	VPCMPEQB 32(R14), X1, X4
-	VPCMPEQB 48(R14), X1, X5
-	// VPBLENDVB X2, X12, X11, X2
-	BYTE $0xc4; BYTE $0xc3; BYTE $0x21; BYTE $0x4c; BYTE $0xd4; BYTE $0x20
-	// VPBLENDVB X3, X13, X2, X2
-	BYTE $0xc4; BYTE $0xc3; BYTE $0x69; BYTE $0x4c; BYTE $0xd5; BYTE $0x30
-	PADDB X2, X1
-	// VPBLENDVB X4, X14, X1, X1
-	BYTE $0xc4; BYTE $0xc3; BYTE $0x71; BYTE $0x4c; BYTE $0xce; BYTE $0x40
-	// VPBLENDVB X5, X15, X1, X1
-	BYTE $0xc4; BYTE $0xc3; BYTE $0x71; BYTE $0x4c; BYTE $0xcf; BYTE $0x50
+	// VPADDUSB X12, X1, X2
+	BYTE $0xc4; BYTE $0xc1; BYTE $0x71; BYTE $0xdc; BYTE $0xd4
+	VPSHUFB X2, X8, X0
+	PSUBB X13, X1
+	// VPADDUSB X12, X1, X2
+	BYTE $0xc4; BYTE $0xc1; BYTE $0x71; BYTE $0xdc; BYTE $0xd4
+	VPSHUFB X2, X9, X3
+	POR X3, X0
+	PSUBB X13, X1
+	// VPADDUSB X12, X1, X2
+	BYTE $0xc4; BYTE $0xc1; BYTE $0x71; BYTE $0xdc; BYTE $0xd4
+	VPSHUFB X2, X10, X3
+	POR X3, X0
+	PSUBB X13, X1
+	// VPADDUSB X12, X1, X2
+	BYTE $0xc4; BYTE $0xc1; BYTE $0x71; BYTE $0xdc; BYTE $0xd4
+	VPSHUFB X2, X11, X1
+	POR X0, X1
 	MOVOU X1, (DI)
 	SUBQ $12, BX
 	JZ ret
@@ -221,27 +186,27 @@ bigloop_sse:
 	POR X0, X1
 	PSHUFB encodeShufOut<>(SB), X1
 	MOVOU X1, X2
-	PCMPGTB (R14), X2
-	MOVOU X1, X3
-	PCMPGTB 16(R14), X3
-	MOVOU X1, X4
-	PCMPEQB X1, X4
-	MOVOU X1, X5
-	PCMPEQB X1, X5
-	MOVOU X2, X0
-	MOVOU X11, X2
-	// PBLENDVB X0, X12, X2
-	BYTE $0x66; BYTE $0x41; BYTE $0x0f; BYTE $0x38; BYTE $0x10; BYTE $0xd4
-	MOVOU X3, X0
-	// PBLENDVB X0, X13, X2
-	BYTE $0x66; BYTE $0x41; BYTE $0x0f; BYTE $0x38; BYTE $0x10; BYTE $0xd5
-	PADDB X2, X1
-	MOVOU X4, X0
-	// PBLENDVB X0, X14, X1
-	BYTE $0x66; BYTE $0x41; BYTE $0x0f; BYTE $0x38; BYTE $0x10; BYTE $0xce
-	MOVOU X5, X0
-	// PBLENDVB X0, X15, X1
-	BYTE $0x66; BYTE $0x41; BYTE $0x0f; BYTE $0x38; BYTE $0x10; BYTE $0xcf
+	PADDUSB X12, X2
+	MOVOU X8, X0
+	PSHUFB X2, X0
+	PSUBB X13, X1
+	MOVOU X1, X2
+	PADDUSB X12, X2
+	MOVOU X9, X3
+	PSHUFB X2, X3
+	POR X3, X0
+	PSUBB X13, X1
+	MOVOU X1, X2
+	PADDUSB X12, X2
+	MOVOU X10, X3
+	PSHUFB X2, X3
+	POR X3, X0
+	PSUBB X13, X1
+	MOVOU X1, X2
+	PADDUSB X12, X2
+	MOVOU X11, X1
+	PSHUFB X2, X1
+	POR X0, X1
 	MOVOU X1, (DI)
 	SUBQ $12, BX
 	JZ ret
@@ -252,3 +217,81 @@ bigloop_sse:
 	CMPQ BX, $3
 	JB tail
 	JMP loop_preheader
+bigloop_avx2_preheader:
+	// VBROADCASTI128 (DX), Y8
+	BYTE $0xc4; BYTE $0x62; BYTE $0x7d; BYTE $0x5a; BYTE $0x02
+	// VBROADCASTI128 16(DX), Y9
+	BYTE $0xc4; BYTE $0x62; BYTE $0x7d; BYTE $0x5a; BYTE $0x4a; BYTE $0x10
+	// VBROADCASTI128 32(DX), Y10
+	BYTE $0xc4; BYTE $0x62; BYTE $0x7d; BYTE $0x5a; BYTE $0x52; BYTE $0x20
+	// VBROADCASTI128 48(DX), Y11
+	BYTE $0xc4; BYTE $0x62; BYTE $0x7d; BYTE $0x5a; BYTE $0x5a; BYTE $0x30
+	LEAQ encodeShuf<>(SB), R8
+	// VBROADCASTI128 (R8), Y4
+	BYTE $0xc4; BYTE $0xc2; BYTE $0x7d; BYTE $0x5a; BYTE $0x20
+	LEAQ encodeShufOut<>(SB), R8
+	// VBROADCASTI128 (R8), Y5
+	BYTE $0xc4; BYTE $0xc2; BYTE $0x7d; BYTE $0x5a; BYTE $0x28
+	LEAQ encodeAnd<>(SB), R8
+	// VBROADCASTI128 (R8), Y6
+	BYTE $0xc4; BYTE $0xc2; BYTE $0x7d; BYTE $0x5a; BYTE $0x30
+	// VBROADCASTI128 16(R8), Y7
+	BYTE $0xc4; BYTE $0xc2; BYTE $0x7d; BYTE $0x5a; BYTE $0x78; BYTE $0x10
+	// VBROADCASTI128 32(R8), Y14
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x70; BYTE $0x20
+	// VBROADCASTI128 48(R8), Y15
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x78; BYTE $0x30
+	LEAQ encodeLookup<>(SB), R8
+	// VBROADCASTI128 (R8), Y12
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x20
+	// VBROADCASTI128 16(R8), Y13
+	BYTE $0xc4; BYTE $0x42; BYTE $0x7d; BYTE $0x5a; BYTE $0x68; BYTE $0x10
+bigloop_avx2:
+	VMOVDQU (SI), X1
+	// VINSERTI128 $1, 12(SI), Y1, Y1
+	BYTE $0xc4; BYTE $0xe3; BYTE $0x75; BYTE $0x38; BYTE $0x4e; BYTE $0x0c; BYTE $0x01
+	VPSHUFB Y4, Y1, Y1
+	VPAND Y6, Y1, Y0
+	// VPSLLD $4, Y1, Y1
+	BYTE $0xc5; BYTE $0xf5; BYTE $0x72; BYTE $0xf1; BYTE $0x04
+	VPAND Y7, Y1, Y1
+	VPOR Y0, Y1, Y1
+	VPAND Y14, Y1, Y0
+	// VPSLLD $2, Y1, Y1
+	BYTE $0xc5; BYTE $0xf5; BYTE $0x72; BYTE $0xf1; BYTE $0x02
+	VPAND Y15, Y1, Y1
+	VPOR Y0, Y1, Y1
+	VPSHUFB Y5, Y1, Y1
+	// VPADDUSB Y12, Y1, Y2
+	BYTE $0xc4; BYTE $0xc1; BYTE $0x75; BYTE $0xdc; BYTE $0xd4
+	VPSHUFB Y2, Y8, Y0
+	// VPSUBB Y13, Y1, Y1
+	BYTE $0xc4; BYTE $0xc1; BYTE $0x75; BYTE $0xf8; BYTE $0xcd
+	// VPADDUSB Y12, Y1, Y2
+	BYTE $0xc4; BYTE $0xc1; BYTE $0x75; BYTE $0xdc; BYTE $0xd4
+	VPSHUFB Y2, Y9, Y3
+	VPOR Y3, Y0, Y0
+	// VPSUBB Y13, Y1, Y1
+	BYTE $0xc4; BYTE $0xc1; BYTE $0x75; BYTE $0xf8; BYTE $0xcd
+	// VPADDUSB Y12, Y1, Y2
+	BYTE $0xc4; BYTE $0xc1; BYTE $0x75; BYTE $0xdc; BYTE $0xd4
+	VPSHUFB Y2, Y10, Y3
+	VPOR Y3, Y0, Y0
+	// VPSUBB Y13, Y1, Y1
+	BYTE $0xc4; BYTE $0xc1; BYTE $0x75; BYTE $0xf8; BYTE $0xcd
+	// VPADDUSB Y12, Y1, Y2
+	BYTE $0xc4; BYTE $0xc1; BYTE $0x75; BYTE $0xdc; BYTE $0xd4
+	VPSHUFB Y2, Y11, Y1
+	VPOR Y0, Y1, Y1
+	VMOVDQU Y1, (DI)
+	ADDQ $24, SI
+	ADDQ $32, DI
+	SUBQ $24, BX
+	CMPQ BX, $28
+	JAE bigloop_avx2
+	VZEROUPPER
+	CMPQ BX, $16
+	JAE bigloop_avx
+	CMPQ BX, $3
+	JAE loop_preheader
+	JMP tail
@@ -7,74 +7,158 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// +build !amd64 gccgo appengine
+// +build !amd64 gccgo appengine purego
 
 package base64
 
-import (
-	ref "encoding/base64"
-	"io"
-)
+import "encoding/binary"
 
-type Encoding struct {
-	impl *ref.Encoding
-}
+// encodeTo encodes src, which must not be empty, into dst.
+func (enc Encoding) encodeTo(dst, src []byte) {
+	di, si := 0, 0
+
+	// Encode 6 bytes into 8 characters at a time with a single
+	// 8 byte load and store. The load reads 2 bytes past the
+	// bytes it encodes, and the store writes none past the output.
+	for ; len(src)-si >= 8; si, di = si+6, di+8 {
+		v := binary.BigEndian.Uint64(src[si:])
 
-func newEncoding(encType encodingType) Encoding {
-	switch encType {
-	case encodeStd:
-		return Encoding{ref.StdEncoding}
-	case encodeURL:
-		return Encoding{ref.URLEncoding}
-	default:
-		panic("invalid encoding type")
+		binary.BigEndian.PutUint64(dst[di:],
+			uint64(enc.encodePair[v>>52])<<48|
+				uint64(enc.encodePair[v>>40&0xfff])<<32|
+				uint64(enc.encodePair[v>>28&0xfff])<<16|
+				uint64(enc.encodePair[v>>16&0xfff]))
 	}
-}
 
-func (enc Encoding) WithPadding(padding rune) Encoding {
-	return Encoding{enc.impl.WithPadding(padding)}
-}
+	for n := len(src) / 3 * 3; si < n; si, di = si+3, di+4 {
+		v := uint(src[si])<<16 | uint(src[si+1])<<8 | uint(src[si+2])
 
-// TODO: func (enc Encoding) Strict() Encoding {}
+		binary.BigEndian.PutUint16(dst[di:], enc.encodePair[v>>12])
+		binary.BigEndian.PutUint16(dst[di+2:], enc.encodePair[v&0xfff])
+	}
+
+	remain := len(src) - si
+	if remain == 0 {
+		return
+	}
 
-func (enc Encoding) Decode(dst, src []byte) (n int, err error) {
-	n, err = enc.impl.Decode(dst, src)
-	if _, ok := err.(ref.CorruptInputError); ok {
-		err = ErrFormat
+	// Add the remaining small block
+	val := uint(src[si]) << 16
+	if remain == 2 {
+		val |= uint(src[si+1]) << 8
 	}
 
-	return
+	dst[di+0] = enc.encode[val>>18&0x3f]
+	dst[di+1] = enc.encode[val>>12&0x3f]
+
+	switch remain {
+	case 2:
+		dst[di+2] = enc.encode[val>>6&0x3f]
+		if enc.padding != NoPadding {
+			dst[di+3] = byte(enc.padding)
+		}
+	case 1:
+		if enc.padding != NoPadding {
+			dst[di+2] = byte(enc.padding)
+			dst[di+3] = byte(enc.padding)
+		}
+	}
 }
 
-func (enc Encoding) DecodeString(s string) (b []byte, err error) {
-	b, err = enc.impl.DecodeString(s)
-	if _, ok := err.(ref.CorruptInputError); ok {
-		err = ErrFormat
+// decode decodes src into dst. If src contains an invalid character, the
+// quanta before it are decoded and its offset is returned with ok false.
+//
+// Each character is mapped to its value already shifted into place, so a
+// quantum is decoded by OR-ing four lookups, and invalid characters are
+// detected once for every 8 characters.
+func (enc Encoding) decode(dst, src []byte) (n int, ok bool) {
+	t := &enc.decodeShift
+	si := 0
+
+	// Decode 8 characters into 6 bytes at a time with a single
+	// 8 byte store, which writes 2 bytes past the output.
+	for ; len(src)-si >= 8 && len(dst)-n >= 8; si, n = si+8, n+6 {
+		s := src[si : si+8]
+
+		a := t[0][s[0]] | t[1][s[1]] | t[2][s[2]] | t[3][s[3]]
+		b := t[0][s[4]] | t[1][s[5]] | t[2][s[6]] | t[3][s[7]]
+		if a|b > 0xffffff {
+			break
+		}
+
+		binary.BigEndian.PutUint64(dst[n:], uint64(a)<<40|uint64(b)<<16)
 	}
 
-	return
-}
+	for ; len(src)-si >= 4; si, n = si+4, n+3 {
+		s := src[si : si+4]
 
-func (enc Encoding) DecodedLen(n int) int {
-	return enc.impl.DecodedLen(n)
-}
+		a := t[0][s[0]] | t[1][s[1]] | t[2][s[2]] | t[3][s[3]]
+		if a > 0xffffff {
+			return si + enc.firstInvalid(s), false
+		}
 
-func (enc Encoding) Encode(dst, src []byte) {
-	return enc.impl.Encode(dst, src)
-}
+		dst[n+0] = byte(a >> 16)
+		dst[n+1] = byte(a >> 8)
+		dst[n+2] = byte(a)
+	}
 
-func (enc Encoding) EncodeToString(src []byte) string {
-	return enc.impl.EncodeToString(src)
-}
+	s := src[si:]
+
+	var a uint32
+	switch len(s) {
+	case 0:
+		return n, true
+	case 1:
+		return si, false
+	case 2:
+		a = t[0][s[0]] | t[1][s[1]]
+	case 3:
+		a = t[0][s[0]] | t[1][s[1]] | t[2][s[2]]
+	}
+
+	if a > 0xffffff {
+		return si + enc.firstInvalid(s), false
+	}
 
-func (enc Encoding) EncodedLen(n int) int {
-	return enc.impl.EncodedLen(n)
+	dst[n] = byte(a >> 16)
+	if len(s) == 3 {
+		dst[n+1] = byte(a >> 8)
+	}
+
+	return n + len(s) - 1, true
 }
 
-func NewDecoder(enc Encoding, r io.Reader) io.Reader {
-	return ref.NewDecoder(enc.impl, r)
+// valid reports whether every character of src is in the alphabet. If
+// not, the offset of the first that is not is returned with ok false.
+func (enc Encoding) valid(src []byte) (n int, ok bool) {
+	t := &enc.decodeShift
+
+	for ; len(src)-n >= 8; n += 8 {
+		s := src[n : n+8]
+
+		if t[0][s[0]]|t[1][s[1]]|t[2][s[2]]|t[3][s[3]]|
+			t[0][s[4]]|t[1][s[5]]|t[2][s[6]]|t[3][s[7]] > 0xffffff {
+			break
+		}
+	}
+
+	for ; n < len(src); n++ {
+		if enc.decodeMap[src[n]] == invalidIndex {
+			return n, false
+		}
+	}
+
+	return n, true
 }
 
-func NewEncoder(enc Encoding, w io.Writer) io.WriteCloser {
-	return ref.NewEncoder(enc.impl, w)
+// firstInvalid returns the index of the first character in
+// s that is not in the alphabet.
+func (enc Encoding) firstInvalid(s []byte) int {
+	for i, c := range s {
+		if enc.decodeMap[c] == invalidIndex {
+			return i
+		}
+	}
+
+	panic("no invalid character")
 }
@@ -6,10 +6,15 @@
 package base64
 
 import (
+	"bytes"
 	ref "encoding/base64"
 	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
 	"math/rand"
 	"reflect"
+	"runtime/debug"
 	"testing"
 	"testing/quick"
 )
@@ -49,19 +54,60 @@ func TestEncode(t *testing.T) {
 	})
 }
 
-func testDecode(t *testing.T, enc Encoding, scale float64, maxsize int) {
+func TestEncodeAlphabets(t *testing.T) {
+	for _, e := range encodings {
+		t.Run(e.name, func(t *testing.T) {
+			for l := 0; l < 256; l++ {
+				data := make([]byte, l)
+				rand.Read(data)
+
+				if got, expect := e.enc.EncodeToString(data), e.ref.EncodeToString(data); got != expect {
+					t.Fatalf("EncodeToString(%x) = %q, expected %q", data, got, expect)
+				}
+			}
+		})
+	}
+}
+
+func TestNewEncodingPanics(t *testing.T) {
+	for _, alphabet := range []string{
+		encodeStd[:63],
+		encodeStd + "=",
+		encodeStd[:63] + "\n",
+		encodeStd[:63] + "A",
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewEncoding(%q) did not panic", alphabet)
+				}
+			}()
+
+			NewEncoding(alphabet)
+		}()
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("WithPadding('A') did not panic")
+		}
+	}()
+
+	StdEncoding.WithPadding('A')
+}
+
+func testDecode(t *testing.T, enc Encoding, ref *ref.Encoding, scale float64, maxsize int) {
 	if err := quick.CheckEqual(func(s string) (string, error) {
-		b, err := ref.RawStdEncoding.DecodeString(s)
+		b, err := ref.DecodeString(s)
 		return hex.EncodeToString(b), err
 	}, func(s string) (string, error) {
 		b, err := enc.DecodeString(s)
 		return hex.EncodeToString(b), err
 	}, &quick.Config{
 		Values: func(args []reflect.Value, rand *rand.Rand) {
-			//src := make([]byte, 1+rand.Intn(maxsize))
-			src := make([]byte, maxsize)
+			src := make([]byte, rand.Intn(maxsize))
 			rand.Read(src)
-			data := enc.EncodeToString(src)
+			data := ref.EncodeToString(src)
 			args[0] = reflect.ValueOf(data)
 		},
 
@@ -72,21 +118,768 @@ func testDecode(t *testing.T, enc Encoding, scale float64, maxsize int) {
 }
 
 func TestDecode(t *testing.T) {
-	/*t.Run("Short", func(t *testing.T) {
-		testDecode(t, StdEncoding, 1000, 7)
-	})*/
+	t.Run("Short", func(t *testing.T) {
+		testDecode(t, StdEncoding, ref.StdEncoding, 100, 7)
+	})
+
+	t.Run("Std", func(t *testing.T) {
+		testDecode(t, StdEncoding, ref.StdEncoding, 2, 1024*1024)
+	})
+
+	t.Run("URL", func(t *testing.T) {
+		testDecode(t, URLEncoding, ref.URLEncoding, 2, 1024*1024)
+	})
 
 	t.Run("RawStd", func(t *testing.T) {
-		testDecode(t, RawStdEncoding, 2, 24)
+		testDecode(t, RawStdEncoding, ref.RawStdEncoding, 2, 1024*1024)
 	})
 
-	/*t.Run("Std", func(t *testing.T) {
-		testDecode(t, StdEncoding, 2, 1024*1024)
+	t.Run("RawURL", func(t *testing.T) {
+		testDecode(t, RawURLEncoding, ref.RawURLEncoding, 2, 1024*1024)
 	})
+}
 
-	t.Run("URL", func(t *testing.T) {
-		testDecode(t, URLEncoding, 2, 1024*1024)
-	})*/
+const (
+	encodeBcrypt   = "./ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	encodeCrypt    = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	encodeIMAP     = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+,"
+	encodeReversed = "/+9876543210zyxwvutsrqponmlkjihgfedcbaZYXWVUTSRQPONMLKJIHGFEDCBA"
+	encodeHigh     = "\xc0\xc1\xc2\xc3\xc4\xc5\xc6\xc7\xc8\xc9\xca\xcb\xcc\xcd\xce\xcf" +
+		"\xd0\xd1\xd2\xd3\xd4\xd5\xd6\xd7\xd8\xd9\xda\xdb\xdc\xdd\xde\xdf" +
+		"\xe0\xe1\xe2\xe3\xe4\xe5\xe6\xe7\xe8\xe9\xea\xeb\xec\xed\xee\xef" +
+		"\xf0\xf1\xf2\xf3\xf4\xf5\xf6\xf7\xf8\xf9\xfa\xfb\xfc\xfd\xfe\xff"
+)
+
+var encodings = []struct {
+	name string
+	enc  Encoding
+	ref  *ref.Encoding
+}{
+	{"Std", StdEncoding, ref.StdEncoding},
+	{"URL", URLEncoding, ref.URLEncoding},
+	{"RawStd", RawStdEncoding, ref.RawStdEncoding},
+	{"RawURL", RawURLEncoding, ref.RawURLEncoding},
+	{"Bcrypt", NewEncoding(encodeBcrypt).WithPadding(NoPadding), ref.NewEncoding(encodeBcrypt).WithPadding(ref.NoPadding)},
+	{"Crypt", NewEncoding(encodeCrypt), ref.NewEncoding(encodeCrypt)},
+	{"IMAP", NewEncoding(encodeIMAP).WithPadding(NoPadding), ref.NewEncoding(encodeIMAP).WithPadding(ref.NoPadding)},
+	{"Reversed", NewEncoding(encodeReversed), ref.NewEncoding(encodeReversed)},
+	{"High", NewEncoding(encodeHigh), ref.NewEncoding(encodeHigh)},
+}
+
+// refDecode decodes src with enc. encoding/base64 only reports the
+// offset of corrupt input, so only the offset of the error is returned.
+func refDecode(enc *ref.Encoding, dst, src []byte) (int, error) {
+	n, err := enc.Decode(dst, src)
+	if e, ok := err.(ref.CorruptInputError); ok {
+		err = CorruptInputError{Offset: int64(e)}
+	}
+
+	return n, err
+}
+
+// sameError reports whether err matches an error returned by refDecode.
+func sameError(err, expect error) bool {
+	e, ok := err.(CorruptInputError)
+	if !ok {
+		return err == expect
+	}
+
+	e.Char, e.Reason = 0, 0
+	return e == expect
+}
+
+func TestDecodeLengths(t *testing.T) {
+	for _, e := range encodings {
+		t.Run(e.name, func(t *testing.T) {
+			for l := 0; l < 256; l++ {
+				data := make([]byte, l)
+				rand.Read(data)
+				src := e.ref.EncodeToString(data)
+
+				for off := 0; off < 16; off++ {
+					buf := make([]byte, off+len(src))
+					copy(buf[off:], src)
+
+					dst := make([]byte, off+e.enc.DecodedLen(len(src)))
+
+					n, err := e.enc.Decode(dst[off:], buf[off:])
+					if err != nil {
+						t.Fatalf("length %d, offset %d: %v", l, off, err)
+					}
+
+					if !bytes.Equal(dst[off:off+n], data) {
+						t.Fatalf("length %d, offset %d: decoded %x, expected %x", l, off, dst[off:off+n], data)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDecodedLenExact(t *testing.T) {
+	for _, e := range encodings {
+		t.Run(e.name, func(t *testing.T) {
+			for _, enc := range []Encoding{
+				e.enc,
+				e.enc.WithLineWrap(8, "\r\n"),
+			} {
+				for l := 0; l < 96; l++ {
+					data := make([]byte, l)
+					rand.Read(data)
+					src := enc.EncodeToString(data)
+
+					if n := enc.DecodedLenExact([]byte(src)); n != l {
+						t.Fatalf("DecodedLenExact(%q) = %d, expected %d", src, n, l)
+					}
+
+					if got, err := enc.DecodeString(src); err != nil || len(got) != l || cap(got) != l {
+						t.Fatalf("DecodeString(%q) returned %d bytes with capacity %d, %v, expected %d, nil",
+							src, len(got), cap(got), err, l)
+					}
+
+					// Ignored bytes are counted as characters.
+					if n := enc.DecodedLenExact([]byte(src + "\r\n")); n < l || n > enc.DecodedLen(len(src)+2) {
+						t.Fatalf("DecodedLenExact(%q) = %d, expected between %d and %d",
+							src+"\r\n", n, l, enc.DecodedLen(len(src)+2))
+					}
+				}
+			}
+		})
+	}
+
+	for _, src := range []string{"QQ", "QQ==", "QUI", "QUI=", "QUJD", "QUJDRA"} {
+		got, err := AnyEncoding.DecodeString(src)
+		if n := AnyEncoding.DecodedLenExact([]byte(src)); err != nil || n != len(got) || cap(got) != n {
+			t.Errorf("AnyEncoding.DecodedLenExact(%q) = %d, decoded %d bytes with capacity %d, %v",
+				src, n, len(got), cap(got), err)
+		}
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	for _, e := range encodings {
+		t.Run(e.name, func(t *testing.T) {
+			for l := 0; l < 96; l++ {
+				data := make([]byte, l)
+				rand.Read(data)
+				src := []byte(e.ref.EncodeToString(data))
+
+				for i := 0; i < len(src)+4; i++ {
+					for _, c := range []byte{'=', '*', '.', 0x00, 0x80, 0xff} {
+						bad := make([]byte, len(src))
+						copy(bad, src)
+
+						if i < len(bad) {
+							bad[i] = c
+						} else {
+							bad = append(bad, bytes.Repeat([]byte{'A'}, i-len(src))...)
+							bad = append(bad, c)
+						}
+
+						expect := make([]byte, len(bad))
+						en, eerr := refDecode(e.ref, expect, bad)
+
+						dst := make([]byte, e.enc.DecodedLen(len(bad))+3)
+						n, err := e.enc.Decode(dst, bad)
+
+						if n != en || !sameError(err, eerr) || !bytes.Equal(dst[:n], expect[:en]) {
+							t.Fatalf("Decode(%q) = %d, %v (%x), expected %d, %v (%x)",
+								bad, n, err, dst[:n], en, eerr, expect[:en])
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeStrict(t *testing.T) {
+	for _, e := range encodings {
+		t.Run(e.name, func(t *testing.T) {
+			enc, ref := e.enc.Strict(), e.ref.Strict()
+
+			for l := 1; l < 64; l++ {
+				data := make([]byte, l)
+				rand.Read(data)
+				src := []byte(ref.EncodeToString(data))
+
+				last := len(src) - 1
+				for src[last] == '=' {
+					last--
+				}
+
+				for _, suffix := range []string{"", "A", "="} {
+					for c := 0; c < 64; c++ {
+						bad := append(append([]byte(nil), src...), suffix...)
+						bad[last] = ref.EncodeToString([]byte{byte(c << 2)})[0]
+
+						expect := make([]byte, len(bad))
+						en, eerr := refDecode(ref, expect, bad)
+
+						dst := make([]byte, enc.DecodedLen(len(bad))+3)
+						n, err := enc.Decode(dst, bad)
+
+						if n != en || !sameError(err, eerr) || !bytes.Equal(dst[:n], expect[:en]) {
+							t.Fatalf("Decode(%q) = %d, %v (%x), expected %d, %v (%x)",
+								bad, n, err, dst[:n], en, eerr, expect[:en])
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+// refAnyDecode decodes src as AnyEncoding does, with encoding/base64 and
+// only the offset of any error.
+func refAnyDecode(dst, src []byte) (int, error) {
+	norm := bytes.Map(func(r rune) rune {
+		switch r {
+		case '-':
+			return '+'
+		case '_':
+			return '/'
+		}
+
+		return r
+	}, src)
+
+	if bytes.IndexByte(src, '=') < 0 {
+		return refDecode(ref.RawStdEncoding, dst, norm)
+	}
+
+	return refDecode(ref.StdEncoding, dst, norm)
+}
+
+func TestAnyEncoding(t *testing.T) {
+	for _, e := range encodings[:4] {
+		t.Run(e.name, func(t *testing.T) {
+			for l := 0; l < 300; l++ {
+				data := make([]byte, l)
+				rand.Read(data)
+				src := []byte(e.ref.EncodeToString(data))
+
+				// Mix the alphabets.
+				for i, c := range src {
+					if rand.Intn(2) == 0 {
+						continue
+					}
+
+					switch c {
+					case '+':
+						src[i] = '-'
+					case '-':
+						src[i] = '+'
+					case '/':
+						src[i] = '_'
+					case '_':
+						src[i] = '/'
+					}
+				}
+
+				dst := make([]byte, AnyEncoding.DecodedLen(len(src)))
+				if n, err := AnyEncoding.Decode(dst, src); err != nil || !bytes.Equal(dst[:n], data) {
+					t.Fatalf("Decode(%q) = %x, %v, expected %x, nil", src, dst[:n], err, data)
+				}
+
+				r := NewDecoder(AnyEncoding, bytes.NewReader(src))
+				if got, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(got, data) {
+					t.Fatalf("NewDecoder(%q) = %x, %v, expected %x, nil", src, got, err, data)
+				}
+			}
+		})
+	}
+
+	if got := AnyEncoding.EncodeToString([]byte{0xfb, 0xff}); got != "+/8=" {
+		t.Errorf("EncodeToString = %q, expected %q", got, "+/8=")
+	}
+}
+
+func TestAnyEncodingInvalid(t *testing.T) {
+	for l := 0; l < 96; l++ {
+		data := make([]byte, l)
+		rand.Read(data)
+		src := []byte(ref.URLEncoding.EncodeToString(data))
+
+		for i := 0; i < len(src)+4; i++ {
+			for _, c := range []byte{'=', '*', ',', '.', 0x00, 0x80, 0xff} {
+				bad := append([]byte(nil), src...)
+
+				if i < len(bad) {
+					bad[i] = c
+				} else {
+					bad = append(bad, bytes.Repeat([]byte{'A'}, i-len(src))...)
+					bad = append(bad, c)
+				}
+
+				expect := make([]byte, len(bad))
+				en, eerr := refAnyDecode(expect, bad)
+
+				dst := make([]byte, AnyEncoding.DecodedLen(len(bad)))
+				n, err := AnyEncoding.Decode(dst, bad)
+
+				if n != en || !sameError(err, eerr) || !bytes.Equal(dst[:n], expect[:en]) {
+					t.Fatalf("Decode(%q) = %d, %v (%x), expected %d, %v (%x)",
+						bad, n, err, dst[:n], en, eerr, expect[:en])
+				}
+			}
+		}
+	}
+}
+
+// ignored maps the bytes skipped by TestDecodeIgnore to those that
+// encoding/base64 skips, so that errors are reported at the same offsets.
+var ignored = map[byte]byte{' ': '\n', '\t': '\r', '\r': '\r', '\n': '\n'}
+
+func TestDecodeIgnore(t *testing.T) {
+	for _, e := range encodings {
+		t.Run(e.name, func(t *testing.T) {
+			for _, strict := range []bool{false, true} {
+				enc, ref := e.enc.WithIgnore(" \t\r\n"), e.ref
+				if strict {
+					enc, ref = enc.Strict(), ref.Strict()
+				}
+
+				for l := 0; l < 96; l++ {
+					data := make([]byte, l)
+					rand.Read(data)
+					src := e.ref.EncodeToString(data)
+
+					for i := 0; i < 16; i++ {
+						var bad []byte
+						for j := 0; j <= len(src); j++ {
+							for rand.Intn(4) == 0 {
+								bad = append(bad, " \t\r\n"[rand.Intn(4)])
+							}
+
+							if j < len(src) {
+								bad = append(bad, src[j])
+							}
+						}
+
+						if i&1 != 0 && len(bad) != 0 {
+							bad[rand.Intn(len(bad))] = "=*A"[rand.Intn(3)]
+						}
+
+						refSrc := make([]byte, len(bad))
+						for j, c := range bad {
+							if r, ok := ignored[c]; ok {
+								c = r
+							}
+
+							refSrc[j] = c
+						}
+
+						expect := make([]byte, len(bad))
+						en, eerr := refDecode(ref, expect, refSrc)
+
+						buf := make([]byte, enc.DecodedLen(len(bad))+32)
+						canary(buf)
+
+						dst := buf[:enc.decodedLen(bad)]
+						n, err := enc.Decode(dst, bad)
+
+						if n != en || !sameError(err, eerr) || !bytes.Equal(dst[:n], expect[:en]) {
+							t.Fatalf("Decode(%q) = %d, %v (%x), expected %d, %v (%x)",
+								bad, n, err, dst[:n], en, eerr, expect[:en])
+						}
+
+						checkCanary(t, buf[len(dst):], "Decode(%q)", bad)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestWithIgnore(t *testing.T) {
+	if _, err := StdEncoding.WithIgnore("").DecodeString("QUJD\nREVG"); err != (CorruptInputError{4, '\n', InvalidCharacter}) {
+		t.Errorf("WithIgnore(\"\") did not reject newline, returned %v", err)
+	}
+
+	got, err := StdEncoding.WithIgnore(" ").DecodeString(" QU JD REVG ")
+	if err != nil || string(got) != "ABCDEF" {
+		t.Errorf("WithIgnore(\" \") returned %q, %v, expected %q, nil", got, err, "ABCDEF")
+	}
+
+	if _, err := StdEncoding.WithIgnore(" ").DecodeString("QUJD\nREVG"); err == nil {
+		t.Error("WithIgnore(\" \") did not reject newline")
+	}
+
+	for _, chars := range []string{"A", " =", "\n+"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("WithIgnore(%q) did not panic", chars)
+				}
+			}()
+
+			StdEncoding.WithIgnore(chars)
+		}()
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("WithPadding did not panic with padding in the ignored characters")
+		}
+	}()
+
+	RawStdEncoding.WithIgnore(" .").WithPadding('.')
+}
+
+func TestValid(t *testing.T) {
+	for _, e := range encodings {
+		t.Run(e.name, func(t *testing.T) {
+			for _, enc := range []Encoding{
+				e.enc,
+				e.enc.Strict(),
+				e.enc.WithIgnore(" \t\r\n"),
+				e.enc.WithLineWrap(8, "\r\n"),
+				e.enc.WithIgnore("").WithLineWrap(8, "\r\n"),
+				AnyEncoding,
+				AnyEncoding.Strict(),
+			} {
+				for l := 0; l < 160; l++ {
+					data := make([]byte, l)
+					rand.Read(data)
+					src := []byte(enc.EncodeToString(data))
+
+					for i := 0; i < 8; i++ {
+						bad := append([]byte(nil), src...)
+
+						if i&1 != 0 && len(bad) != 0 {
+							c := byte(rand.Intn(256))
+							if rand.Intn(2) == 0 {
+								c = "=*A-_ \n"[rand.Intn(7)]
+							}
+
+							bad[rand.Intn(len(bad))] = c
+						}
+
+						if i&2 != 0 {
+							bad = bad[:rand.Intn(len(bad)+1)]
+						}
+
+						dst := make([]byte, enc.DecodedLen(len(bad)))
+						_, err := enc.Decode(dst, bad)
+
+						if valid := enc.Valid(bad); valid != (err == nil) {
+							t.Fatalf("Valid(%q) = %t, Decode returned %v", bad, valid, err)
+						}
+
+						if valid := enc.ValidString(string(bad)); valid != (err == nil) {
+							t.Fatalf("ValidString(%q) = %t, Decode returned %v", bad, valid, err)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestValidPrefix(t *testing.T) {
+	for _, e := range encodings {
+		t.Run(e.name, func(t *testing.T) {
+			for _, enc := range []Encoding{
+				e.enc,
+				e.enc.Strict(),
+				e.enc.WithIgnore(" \t\r\n"),
+				e.enc.WithLineWrap(8, "\r\n"),
+				e.enc.WithIgnore("").WithLineWrap(8, "\r\n"),
+				AnyEncoding,
+				AnyEncoding.Strict(),
+			} {
+				for l := 0; l < 100; l++ {
+					data := make([]byte, l)
+					rand.Read(data)
+					src := []byte(enc.EncodeToString(data))
+
+					for i := 0; i < 8; i++ {
+						bad := append([]byte(nil), src...)
+
+						for j := 0; j < i && len(bad) != 0; j++ {
+							bad[rand.Intn(len(bad))] = "=*A-_ \r\n"[rand.Intn(8)]
+						}
+
+						expect := len(bad)
+						for !enc.Valid(bad[:expect]) {
+							expect--
+						}
+
+						if n := enc.ValidPrefix(bad); n != expect {
+							t.Fatalf("ValidPrefix(%q) = %d, expected %d", bad, n, expect)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCorruptInputError(t *testing.T) {
+	for _, test := range []struct {
+		enc    Encoding
+		src    string
+		expect CorruptInputError
+	}{
+		{StdEncoding, "QUJD*EFC", CorruptInputError{4, '*', InvalidCharacter}},
+		{StdEncoding, "QUJDRE\x80C", CorruptInputError{6, 0x80, InvalidCharacter}},
+		{StdEncoding, "QUJDR===", CorruptInputError{5, '=', InvalidPadding}},
+		{StdEncoding, "QUJDRE=C", CorruptInputError{6, '=', InvalidPadding}},
+		{StdEncoding, "QUJDRQ==QUJD", CorruptInputError{8, 'Q', InvalidPadding}},
+		{StdEncoding, "QUJDRQ==*", CorruptInputError{8, '*', InvalidCharacter}},
+		{StdEncoding, "QUJDRQ=", CorruptInputError{7, 0, Truncated}},
+		{StdEncoding, "QUJDRUZ", CorruptInputError{4, 'R', Truncated}},
+		{RawStdEncoding, "QUJDR", CorruptInputError{4, 'R', Truncated}},
+		{RawStdEncoding, "QUJDRQ=", CorruptInputError{6, '=', InvalidCharacter}},
+		{StdEncoding.Strict(), "QUJDRR==", CorruptInputError{6, '=', NonCanonical}},
+		{StdEncoding.Strict(), "QUJDRUZ=", CorruptInputError{7, '=', NonCanonical}},
+		{StdEncoding.Strict(), "QUJDRUZH", CorruptInputError{}},
+		{RawStdEncoding.Strict(), "QUJDRUZ", CorruptInputError{6, 'Z', NonCanonical}},
+		{RawStdEncoding.Strict(), "QUJDRR", CorruptInputError{4, 'R', NonCanonical}},
+	} {
+		dst := make([]byte, test.enc.DecodedLen(len(test.src)))
+		_, err := test.enc.Decode(dst, []byte(test.src))
+
+		if test.expect == (CorruptInputError{}) {
+			if err != nil {
+				t.Errorf("Decode(%q) returned %v, expected nil", test.src, err)
+			}
+
+			continue
+		}
+
+		if err != test.expect {
+			t.Errorf("Decode(%q) returned %#v, expected %#v", test.src, err, test.expect)
+		}
+
+		if !errors.Is(err, ErrFormat) {
+			t.Errorf("errors.Is(%v, ErrFormat) = false", err)
+		}
+
+		if _, err = test.enc.DecodeString(test.src); err != test.expect {
+			t.Errorf("DecodeString(%q) returned %#v, expected %#v", test.src, err, test.expect)
+		}
+	}
+}
+
+func TestAppend(t *testing.T) {
+	for _, e := range encodings {
+		t.Run(e.name, func(t *testing.T) {
+			for l := 0; l < 256; l++ {
+				data := make([]byte, l)
+				rand.Read(data)
+
+				prefix := make([]byte, rand.Intn(16), 32)
+				rand.Read(prefix)
+
+				encoded := e.enc.AppendEncode(prefix, data)
+				if expect := string(prefix) + e.ref.EncodeToString(data); string(encoded) != expect {
+					t.Fatalf("AppendEncode(%x, %x) = %q, expected %q", prefix, data, encoded, expect)
+				}
+
+				decoded, err := e.enc.AppendDecode(prefix, encoded[len(prefix):])
+				if err != nil {
+					t.Fatalf("AppendDecode(%x, %q) returned %v", prefix, encoded[len(prefix):], err)
+				}
+
+				if expect := append(prefix[:len(prefix):len(prefix)], data...); !bytes.Equal(decoded, expect) {
+					t.Fatalf("AppendDecode(%x, %q) = %x, expected %x", prefix, encoded[len(prefix):], decoded, expect)
+				}
+			}
+		})
+	}
+}
+
+func TestAppendDecodeError(t *testing.T) {
+	dst, err := StdEncoding.AppendDecode([]byte("x"), []byte("QUJD*EFC"))
+	if expect := (CorruptInputError{4, '*', InvalidCharacter}); err != expect {
+		t.Fatalf("AppendDecode returned %v, expected %v", err, expect)
+	}
+
+	if string(dst) != "xABC" {
+		t.Fatalf("AppendDecode = %q, expected %q", dst, "xABC")
+	}
+}
+
+func TestAppendAllocs(t *testing.T) {
+	data := make([]byte, 1024)
+	rand.Read(data)
+
+	src := []byte(StdEncoding.EncodeToString(data))
+	buf := make([]byte, 0, len(src))
+
+	if n := testing.AllocsPerRun(100, func() {
+		buf = StdEncoding.AppendEncode(buf[:0], data)
+		buf, _ = StdEncoding.AppendDecode(buf[:0], src)
+	}); n != 0 {
+		t.Fatalf("AppendEncode and AppendDecode allocated %f times, expected 0", n)
+	}
+}
+
+// canary fills b with a byte that Encode and Decode should not write.
+func canary(b []byte) {
+	for i := range b {
+		b[i] = 0xa5
+	}
+}
+
+func checkCanary(t *testing.T, b []byte, format string, args ...interface{}) {
+	for i, c := range b {
+		if c != 0xa5 {
+			t.Fatalf(format+": wrote %#02x past dst at %d", append(args, c, i)...)
+		}
+	}
+}
+
+func TestBounds(t *testing.T) {
+	for _, e := range encodings {
+		t.Run(e.name, func(t *testing.T) {
+			for l := 0; l < 256; l++ {
+				data := make([]byte, l)
+				rand.Read(data)
+				src := []byte(e.ref.EncodeToString(data))
+
+				buf := make([]byte, len(src)+32)
+				canary(buf)
+
+				e.enc.Encode(buf[:len(src)], data)
+				checkCanary(t, buf[len(src):], "Encode(%x)", data)
+
+				canary(buf)
+
+				n, err := e.enc.Decode(buf[:l], src)
+				if err != nil || n != l {
+					t.Fatalf("Decode(%q) returned %d, %v, expected %d, nil", src, n, err, l)
+				}
+
+				checkCanary(t, buf[l:], "Decode(%q)", src)
+
+				if l == 0 {
+					continue
+				}
+
+				canary(buf)
+
+				if n, err := e.enc.Decode(buf[:l-1], src); n != 0 || err != io.ErrShortBuffer {
+					t.Fatalf("Decode(%q) into %d bytes returned %d, %v, expected 0, %v", src, l-1, n, err, io.ErrShortBuffer)
+				}
+
+				checkCanary(t, buf[:], "Decode(%q) into %d bytes", src, l-1)
+
+				func() {
+					defer func() {
+						if recover() == nil {
+							t.Fatalf("Encode(%x) into %d bytes did not panic", data, len(src)-1)
+						}
+					}()
+
+					e.enc.Encode(buf[:len(src)-1], data)
+				}()
+			}
+		})
+	}
+}
+
+// noFault calls fn and fails t if fn reads or writes past the memory
+// that it was given and into a guard page.
+func noFault(t *testing.T, fn func(), format string, args ...interface{}) {
+	defer func() {
+		if err := recover(); err != nil {
+			t.Fatalf(format+": %v", append(args, err)...)
+		}
+	}()
+
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	fn()
+}
+
+// TestGuardPage places src and dst flush against a page that faults on
+// access, so that it catches reads past the end of src, such as a vector
+// load of which only some bytes are used, as well as writes.
+func TestGuardPage(t *testing.T) {
+	page, unmap, err := guardedPage()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	defer unmap()
+
+	// guarded returns b copied to the end of page.
+	guarded := func(b []byte) []byte {
+		g := page[len(page)-len(b):]
+		copy(g, b)
+		return g
+	}
+
+	for _, e := range encodings {
+		t.Run(e.name, func(t *testing.T) {
+			for l := 0; l <= 64; l++ {
+				data := make([]byte, l)
+				rand.Read(data)
+				expect := e.ref.EncodeToString(data)
+
+				dst := make([]byte, len(expect))
+				noFault(t, func() {
+					e.enc.Encode(dst, guarded(data))
+				}, "Encode(%x)", data)
+
+				if string(dst) != expect {
+					t.Fatalf("Encode(%x) = %q, expected %q", data, dst, expect)
+				}
+
+				noFault(t, func() {
+					dst = guarded(make([]byte, len(expect)))
+					e.enc.Encode(dst, data)
+				}, "Encode(%x) into a guarded dst", data)
+
+				if string(dst) != expect {
+					t.Fatalf("Encode(%x) into a guarded dst = %q, expected %q", data, dst, expect)
+				}
+
+				for _, test := range []struct {
+					src   string
+					valid bool
+				}{
+					{expect, true},
+					{expect + "\r\n", true},
+					{expect[:len(expect)/2] + "*", false},
+				} {
+					src, valid := test.src, test.valid
+
+					out := make([]byte, len(src))
+					var n int
+					var err error
+					noFault(t, func() {
+						n, err = e.enc.Decode(out, guarded([]byte(src)))
+					}, "Decode(%q)", src)
+
+					if (err == nil) != valid || valid && !bytes.Equal(out[:n], data) {
+						t.Fatalf("Decode(%q) = %x, %v, expected %x", src, out[:n], err, data)
+					}
+
+					noFault(t, func() {
+						if e.enc.Valid(guarded([]byte(src))) != valid {
+							t.Errorf("Valid(%q) = %t, expected %t", src, !valid, valid)
+						}
+					}, "Valid(%q)", src)
+
+					if !valid {
+						continue
+					}
+
+					noFault(t, func() {
+						dst = guarded(make([]byte, e.enc.DecodedLenExact([]byte(src))))
+						n, err = e.enc.Decode(dst, []byte(src))
+					}, "Decode(%q) into a guarded dst", src)
+
+					if err != nil || !bytes.Equal(dst[:n], data) {
+						t.Fatalf("Decode(%q) into a guarded dst = %x, %v, expected %x", src, dst[:n], err, data)
+					}
+				}
+			}
+		})
+	}
 }
 
 type size struct {
@@ -140,3 +933,59 @@ func BenchmarkRefEncode(b *testing.B) {
 		})
 	}
 }
+
+func BenchmarkDecode(b *testing.B) {
+	for _, size := range sizes {
+		b.Run(size.name, func(b *testing.B) {
+			data := make([]byte, size.l)
+			rand.Read(data)
+
+			src := []byte(ref.StdEncoding.EncodeToString(data))
+			dst := make([]byte, StdEncoding.DecodedLen(len(src)))
+
+			b.SetBytes(int64(len(src)))
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				StdEncoding.Decode(dst, src)
+			}
+		})
+	}
+}
+
+func BenchmarkValid(b *testing.B) {
+	for _, size := range sizes {
+		b.Run(size.name, func(b *testing.B) {
+			data := make([]byte, size.l)
+			rand.Read(data)
+
+			src := []byte(ref.StdEncoding.EncodeToString(data))
+
+			b.SetBytes(int64(len(src)))
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				StdEncoding.Valid(src)
+			}
+		})
+	}
+}
+
+func BenchmarkRefDecode(b *testing.B) {
+	for _, size := range sizes {
+		b.Run(size.name, func(b *testing.B) {
+			data := make([]byte, size.l)
+			rand.Read(data)
+
+			src := []byte(ref.StdEncoding.EncodeToString(data))
+			dst := make([]byte, ref.StdEncoding.DecodedLen(len(src)))
+
+			b.SetBytes(int64(len(src)))
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				ref.StdEncoding.Decode(dst, src)
+			}
+		})
+	}
+}
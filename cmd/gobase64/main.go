@@ -0,0 +1,307 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+// Command gobase64 base64 encodes or decodes files, or standard input, to
+// standard output. It accepts the options of GNU coreutils base64 and, for
+// valid input, writes the same output:
+//
+//	-d, --decode          decode data
+//	-i, --ignore-garbage  when decoding, ignore non-alphabet characters
+//	-w, --wrap=COLS       wrap encoded lines after COLS characters (default
+//	                      76), or 0 to disable line wrapping
+//
+// It also accepts --url to use the URL and filename safe alphabet, --raw
+// to omit padding, and --strict to reject non-canonical input when
+// decoding. Options are parsed as GNU getopt_long parses them, so -di,
+// -w0, --wrap 0 and --wr=0 are accepted, as are options after FILE.
+//
+// With no FILE, or when FILE is -, it reads standard input. Multiple files
+// are read as if they had been concatenated.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/tmthrgd/go-base64"
+)
+
+const (
+	encodeStd = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+	encodeURL = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+)
+
+const bufferSize = 64 * 1024
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	o, err := parseArgs(args)
+	if err != nil {
+		fmt.Fprintln(stderr, "gobase64:", err)
+		fmt.Fprintln(stderr, "Try 'gobase64 --help' for more information.")
+		return 1
+	}
+
+	if o.help {
+		usage(stdout)
+		return 0
+	}
+
+	alphabet, enc := encodeStd, base64.StdEncoding
+	if o.url {
+		alphabet, enc = encodeURL, base64.URLEncoding
+	}
+
+	if o.raw {
+		enc = enc.WithPadding(base64.NoPadding)
+	}
+
+	if o.strict {
+		enc = enc.Strict()
+	}
+
+	in, closeInputs, err := openInputs(o.files, stdin)
+	if err != nil {
+		fmt.Fprintln(stderr, "gobase64:", err)
+		return 1
+	}
+
+	defer closeInputs()
+
+	out := bufio.NewWriterSize(stdout, bufferSize)
+
+	if o.decode {
+		// GNU base64 only skips newlines unless ignoring garbage.
+		ignore := "\n"
+		if o.ignoreGarbage {
+			ignore = garbage(alphabet, !o.raw)
+		}
+
+		err = decodeTo(out, in, enc, ignore, !o.raw)
+	} else {
+		err = encodeTo(out, in, enc, o.wrap)
+	}
+
+	if ferr := out.Flush(); err == nil {
+		err = ferr
+	}
+
+	if err != nil {
+		fmt.Fprintln(stderr, "gobase64:", err)
+		return 1
+	}
+
+	return 0
+}
+
+// openInputs returns a reader of the named files, or of stdin if there
+// are none, and a function that closes them.
+func openInputs(names []string, stdin io.Reader) (io.Reader, func(), error) {
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+
+	var files []*os.File
+	closeFiles := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+
+	readers := make([]io.Reader, 0, len(names))
+	for _, name := range names {
+		if name == "-" {
+			readers = append(readers, stdin)
+			continue
+		}
+
+		f, err := os.Open(name)
+		if err != nil {
+			closeFiles()
+			return nil, nil, err
+		}
+
+		files = append(files, f)
+		readers = append(readers, f)
+	}
+
+	return io.MultiReader(readers...), closeFiles, nil
+}
+
+// garbage returns every byte that is neither in alphabet nor, if padded,
+// the padding character.
+func garbage(alphabet string, padded bool) string {
+	var seen [256]bool
+	for i := 0; i < len(alphabet); i++ {
+		seen[alphabet[i]] = true
+	}
+
+	seen['='] = padded
+
+	buf := make([]byte, 0, len(seen))
+	for c, ok := range seen {
+		if !ok {
+			buf = append(buf, byte(c))
+		}
+	}
+
+	return string(buf)
+}
+
+// encodeTo writes the base64 encoding of r to w. A newline is written
+// after every wrap characters and after the last line, as GNU base64
+// does.
+func encodeTo(w io.Writer, r io.Reader, enc base64.Encoding, wrap int) error {
+	lw := w
+	if wrap%4 == 0 {
+		// WithLineWrap disables line wrapping for a wrap of zero.
+		enc = enc.WithLineWrap(wrap, "\n")
+	} else {
+		lw = &lineWriter{w: w, width: wrap}
+	}
+
+	e := base64.NewEncoder(enc, lw)
+
+	n, err := io.Copy(e, r)
+	if err != nil {
+		return err
+	}
+
+	if err := e.Close(); err != nil {
+		return err
+	}
+
+	if wrap != 0 && n != 0 {
+		_, err = w.Write(newline)
+	}
+
+	return err
+}
+
+var newline = []byte{'\n'}
+
+// lineWriter writes a newline before any byte that does not fit on the
+// current line of width bytes. It is used for widths that WithLineWrap
+// does not support.
+type lineWriter struct {
+	w     io.Writer
+	width int
+	col   int
+}
+
+func (l *lineWriter) Write(p []byte) (n int, err error) {
+	for len(p) != 0 {
+		if l.col == l.width {
+			if _, err = l.w.Write(newline); err != nil {
+				return
+			}
+
+			l.col = 0
+		}
+
+		m := l.width - l.col
+		if m > len(p) {
+			m = len(p)
+		}
+
+		m, err = l.w.Write(p[:m])
+		n += m
+		l.col += m
+		p = p[m:]
+
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// decodeTo writes the decoding of r to w, skipping the bytes in ignore.
+// If padded, GNU base64 also decodes base64 that follows padding, so that
+// concatenated files may be decoded, so a new decoder is used after each
+// run of padding.
+func decodeTo(w io.Writer, r io.Reader, enc base64.Encoding, ignore string, padded bool) error {
+	enc = enc.WithIgnore(ignore)
+
+	if !padded {
+		_, err := io.Copy(w, base64.NewDecoder(enc, r))
+		return err
+	}
+
+	s := &segmentReader{r: bufio.NewReaderSize(r, bufferSize), ignore: ignore}
+
+	for {
+		if _, err := io.Copy(w, base64.NewDecoder(enc, s)); err != nil {
+			return err
+		}
+
+		if !s.done {
+			return nil
+		}
+
+		s.done, s.inPad = false, false
+	}
+}
+
+// segmentReader reads from r up to the end of the first run of padding,
+// which may contain ignored bytes, and then returns io.EOF until done is
+// cleared.
+type segmentReader struct {
+	r      *bufio.Reader
+	ignore string
+
+	inPad bool // whether the last byte read was in a run of padding
+	done  bool // whether the segment ended with padding
+}
+
+func (s *segmentReader) Read(p []byte) (n int, err error) {
+	if s.done {
+		return 0, io.EOF
+	}
+
+	if s.r.Buffered() == 0 {
+		if _, err := s.r.Peek(1); err != nil {
+			return 0, err
+		}
+	}
+
+	buf, _ := s.r.Peek(s.r.Buffered())
+	if len(buf) > len(p) {
+		buf = buf[:len(p)]
+	}
+
+	i := 0
+	if !s.inPad {
+		if i = bytes.IndexByte(buf, '='); i < 0 {
+			i = len(buf)
+		}
+	}
+
+	if i < len(buf) {
+		for i < len(buf) && (buf[i] == '=' || strings.IndexByte(s.ignore, buf[i]) >= 0) {
+			i++
+		}
+
+		s.inPad = i == len(buf)
+		s.done = !s.inPad
+	}
+
+	n = copy(p, buf[:i])
+	s.r.Discard(n)
+
+	if n == 0 && s.done {
+		return 0, io.EOF
+	}
+
+	return n, nil
+}
@@ -0,0 +1,247 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	ref "encoding/base64"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// refEncode returns the output of GNU base64 -w wrap for data, built with
+// encoding/base64.
+func refEncode(data []byte, wrap int) string {
+	s := ref.StdEncoding.EncodeToString(data)
+	if wrap == 0 || s == "" {
+		return s
+	}
+
+	var buf bytes.Buffer
+	for ; len(s) > wrap; s = s[wrap:] {
+		buf.WriteString(s[:wrap] + "\n")
+	}
+
+	buf.WriteString(s + "\n")
+	return buf.String()
+}
+
+func testRun(t *testing.T, stdin string, args ...string) (stdout string, ok bool) {
+	var out, errOut bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &out, &errOut)
+
+	if code != 0 && errOut.Len() == 0 {
+		t.Errorf("run(%q) failed without writing an error", args)
+	}
+
+	return out.String(), code == 0
+}
+
+var wraps = []int{0, 1, 3, 4, 5, 64, 76, 77}
+
+func TestEncode(t *testing.T) {
+	for _, wrap := range wraps {
+		for l := 0; l < 200; l++ {
+			data := make([]byte, l)
+			rand.Read(data)
+
+			expect := refEncode(data, wrap)
+
+			got, ok := testRun(t, string(data), "-w", strconv.Itoa(wrap))
+			if !ok || got != expect {
+				t.Fatalf("-w %d of %x = %q, %t, expected %q, true", wrap, data, got, ok, expect)
+			}
+
+			got, ok = testRun(t, expect, "-d")
+			if !ok || got != string(data) {
+				t.Fatalf("-d of %q = %x, %t, expected %x, true", expect, got, ok, data)
+			}
+		}
+	}
+}
+
+func TestVariants(t *testing.T) {
+	data := []byte("\xfb\xff\xfe\xfd")
+
+	for _, test := range []struct {
+		args   []string
+		expect string
+	}{
+		{nil, "+//+/Q==\n"},
+		{[]string{"--url"}, "-__-_Q==\n"},
+		{[]string{"--raw"}, "+//+/Q\n"},
+		{[]string{"--url", "--raw", "--wrap=4"}, "-__-\n_Q\n"},
+	} {
+		got, ok := testRun(t, string(data), test.args...)
+		if !ok || got != test.expect {
+			t.Errorf("%q = %q, %t, expected %q, true", test.args, got, ok, test.expect)
+		}
+
+		if got, ok = testRun(t, test.expect, append(test.args, "-d")...); !ok || got != string(data) {
+			t.Errorf("%q -d = %x, %t, expected %x, true", test.args, got, ok, data)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	for _, test := range []struct {
+		args   []string
+		src    string
+		expect string
+		ok     bool
+	}{
+		{nil, "YWJj", "abc", true},
+		{nil, "Y\nW\nJ\nj\n\n", "abc", true},
+		{nil, "YQ==YQ==", "aa", true},
+		{nil, "YQ==\nYWI=\nYWJj\n", "aababc", true},
+		{nil, "YR==", "a", true},
+		{nil, "YWJj\r\n", "abc", false},
+		{nil, "YW*j", "", false},
+		{nil, "YQ=", "", false},
+		{[]string{"-i"}, "Y W*J\r\nj", "abc", true},
+		{[]string{"-i"}, "YQ==*YQ==", "aa", true},
+		{[]string{"--raw"}, "YQ==", "", false},
+		{[]string{"--raw", "-i"}, "YQ==", "a", true},
+		{[]string{"--url"}, "-__-", "\xfb\xff\xfe", true},
+		{[]string{"--url"}, "+//+", "", false},
+		{[]string{"--strict"}, "YR==", "", false},
+	} {
+		got, ok := testRun(t, test.src, append(test.args, "-d")...)
+		if ok != test.ok || ok && got != test.expect {
+			t.Errorf("%q -d of %q = %q, %t, expected %q, %t", test.args, test.src, got, ok, test.expect, test.ok)
+		}
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gobase64")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	if err := ioutil.WriteFile(a, []byte("YWJjZG"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(b, []byte("Z2hp\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The quanta span the files.
+	if got, ok := testRun(t, "Vm", "-d", a, "-", b); !ok || got != "abcdefghi" {
+		t.Errorf("-d %s - %s = %q, %t, expected %q, true", a, b, got, ok, "abcdefghi")
+	}
+
+	if _, ok := testRun(t, "", filepath.Join(dir, "missing")); ok {
+		t.Error("reading a missing file did not fail")
+	}
+
+	if _, ok := testRun(t, "", "-w", "-1"); ok {
+		t.Error("-w -1 did not fail")
+	}
+}
+
+func TestOptions(t *testing.T) {
+	for _, test := range []struct {
+		args   []string
+		expect options
+	}{
+		{nil, options{wrap: 76}},
+		{[]string{"-w0"}, options{wrap: 0}},
+		{[]string{"-w", "0"}, options{wrap: 0}},
+		{[]string{"--wrap=0"}, options{wrap: 0}},
+		{[]string{"--wrap", "0"}, options{wrap: 0}},
+		{[]string{"--wr=8"}, options{wrap: 8}},
+		{[]string{"-di"}, options{decode: true, ignoreGarbage: true, wrap: 76}},
+		{[]string{"-dw", "8"}, options{decode: true, wrap: 8}},
+		{[]string{"-dw8"}, options{decode: true, wrap: 8}},
+		{[]string{"--dec", "--ign", "--st"}, options{decode: true, ignoreGarbage: true, strict: true, wrap: 76}},
+		{[]string{"a", "-d", "b", "--url"}, options{decode: true, url: true, wrap: 76, files: []string{"a", "b"}}},
+		{[]string{"-", "-w4"}, options{wrap: 4, files: []string{"-"}}},
+		{[]string{"-d", "--", "-w4", "--url"}, options{decode: true, wrap: 76, files: []string{"-w4", "--url"}}},
+		{[]string{"--help"}, options{help: true, wrap: 76}},
+	} {
+		o, err := parseArgs(test.args)
+		if err != nil {
+			t.Errorf("parseArgs(%q) returned %v", test.args, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(*o, test.expect) {
+			t.Errorf("parseArgs(%q) = %+v, expected %+v", test.args, *o, test.expect)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"-x"},
+		{"-dx"},
+		{"-w"},
+		{"-d", "--wrap"},
+		{"-w", "-1"},
+		{"-wx"},
+		{"--wrap=x"},
+		{"--decode=1"},
+		{"--nope"},
+	} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("parseArgs(%q) did not fail", args)
+		}
+	}
+
+	if got, ok := testRun(t, "abcdefghijklmnop", "-w0"); !ok || got != "YWJjZGVmZ2hpamtsbW5vcA==" {
+		t.Errorf("-w0 = %q, %t, expected %q, true", got, ok, "YWJjZGVmZ2hpamtsbW5vcA==")
+	}
+
+	if got, ok := testRun(t, "YW*Jj", "-di"); !ok || got != "abc" {
+		t.Errorf("-di = %q, %t, expected %q, true", got, ok, "abc")
+	}
+
+	if got, ok := testRun(t, "", "--help"); !ok || !strings.Contains(got, "--wrap=COLS") {
+		t.Errorf("--help = %q, %t, expected the usage", got, ok)
+	}
+}
+
+// TestGNU compares the output with that of GNU coreutils base64, if it is
+// installed.
+func TestGNU(t *testing.T) {
+	path, err := exec.LookPath("base64")
+	if err != nil {
+		t.Skip("base64 not installed")
+	}
+
+	if out, err := exec.Command(path, "--version").Output(); err != nil || !bytes.Contains(out, []byte("GNU")) {
+		t.Skip("base64 is not GNU coreutils")
+	}
+
+	for _, wrap := range wraps {
+		data := make([]byte, rand.Intn(1000))
+		rand.Read(data)
+
+		args := []string{"-w", strconv.Itoa(wrap)}
+
+		cmd := exec.Command(path, args...)
+		cmd.Stdin = bytes.NewReader(data)
+
+		expect, err := cmd.Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, ok := testRun(t, string(data), args...); !ok || got != string(expect) {
+			t.Errorf("-w %d of %x = %q, %t, expected %q, true", wrap, data, got, ok, expect)
+		}
+	}
+}
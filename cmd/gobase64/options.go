@@ -0,0 +1,204 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// options holds the parsed command line.
+type options struct {
+	decode, ignoreGarbage bool
+	url, raw, strict      bool
+	help                  bool
+
+	wrap  int
+	files []string
+}
+
+// An option is given as -short or --long. If it takes an argument, arg
+// names it in the usage.
+type option struct {
+	short byte // zero if there is no short form
+	long  string
+	arg   string
+	usage string
+
+	set func(o *options, arg string) error
+}
+
+var optionList = []option{
+	{'d', "decode", "", "decode data", func(o *options, _ string) error {
+		o.decode = true
+		return nil
+	}},
+	{'i', "ignore-garbage", "", "when decoding, ignore non-alphabet characters", func(o *options, _ string) error {
+		o.ignoreGarbage = true
+		return nil
+	}},
+	{'w', "wrap", "COLS", "wrap encoded lines after COLS characters (default 76), or 0 to disable line wrapping", func(o *options, arg string) error {
+		wrap, err := strconv.Atoi(arg)
+		if err != nil || wrap < 0 {
+			return fmt.Errorf("invalid wrap size: '%s'", arg)
+		}
+
+		o.wrap = wrap
+		return nil
+	}},
+	{0, "url", "", "use the URL and filename safe alphabet", func(o *options, _ string) error {
+		o.url = true
+		return nil
+	}},
+	{0, "raw", "", "omit padding", func(o *options, _ string) error {
+		o.raw = true
+		return nil
+	}},
+	{0, "strict", "", "when decoding, reject non-zero trailing bits", func(o *options, _ string) error {
+		o.strict = true
+		return nil
+	}},
+	{0, "help", "", "display this help and exit", func(o *options, _ string) error {
+		o.help = true
+		return nil
+	}},
+}
+
+// parseArgs parses args as GNU getopt_long does. Short options may be
+// grouped, as in -di, and the argument of -w may be attached, as in -w0.
+// The argument of --wrap may follow an =, as in --wrap=0, and long options
+// may be abbreviated to any unique prefix. Options may follow the files,
+// and every argument after -- is a file.
+func parseArgs(args []string) (*options, error) {
+	o := &options{wrap: 76}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		switch {
+		case arg == "--":
+			o.files = append(o.files, args[i+1:]...)
+			return o, nil
+		case strings.HasPrefix(arg, "--"):
+			name, val, hasVal := arg[2:], "", false
+			if j := strings.IndexByte(name, '='); j >= 0 {
+				name, val, hasVal = name[:j], name[j+1:], true
+			}
+
+			opt, err := lookupLong(name)
+			if err != nil {
+				return nil, err
+			}
+
+			switch {
+			case opt.arg == "" && hasVal:
+				return nil, fmt.Errorf("option '--%s' doesn't allow an argument", opt.long)
+			case opt.arg != "" && !hasVal:
+				if i++; i == len(args) {
+					return nil, fmt.Errorf("option '--%s' requires an argument", opt.long)
+				}
+
+				val = args[i]
+			}
+
+			if err := opt.set(o, val); err != nil {
+				return nil, err
+			}
+		case len(arg) > 1 && arg[0] == '-':
+			for j := 1; j < len(arg); j++ {
+				opt := lookupShort(arg[j])
+				if opt == nil {
+					return nil, fmt.Errorf("invalid option -- '%c'", arg[j])
+				}
+
+				var val string
+				if opt.arg != "" {
+					// The rest of arg, or else the next
+					// argument, is the option's argument.
+					val, j = arg[j+1:], len(arg)
+					if val == "" {
+						if i++; i == len(args) {
+							return nil, fmt.Errorf("option requires an argument -- '%c'", opt.short)
+						}
+
+						val = args[i]
+					}
+				}
+
+				if err := opt.set(o, val); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			o.files = append(o.files, arg)
+		}
+	}
+
+	return o, nil
+}
+
+// lookupShort returns the option with the short form c, or nil if there is
+// none.
+func lookupShort(c byte) *option {
+	for i := range optionList {
+		if optionList[i].short == c {
+			return &optionList[i]
+		}
+	}
+
+	return nil
+}
+
+// lookupLong returns the option whose long form is name or, failing that,
+// the only one that begins with name.
+func lookupLong(name string) (*option, error) {
+	var match *option
+	for i := range optionList {
+		opt := &optionList[i]
+
+		switch {
+		case opt.long == name:
+			return opt, nil
+		case strings.HasPrefix(opt.long, name):
+			if match != nil {
+				return nil, fmt.Errorf("option '--%s' is ambiguous", name)
+			}
+
+			match = opt
+		}
+	}
+
+	if match == nil {
+		return nil, fmt.Errorf("unrecognized option '--%s'", name)
+	}
+
+	return match, nil
+}
+
+// usage writes the help for the options to w.
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: gobase64 [OPTION]... [FILE]...")
+	fmt.Fprintln(w, "Base64 encode or decode FILE, or standard input, to standard output.")
+	fmt.Fprintln(w)
+
+	for _, opt := range optionList {
+		name := "    --" + opt.long
+		if opt.short != 0 {
+			name = fmt.Sprintf("-%c, --%s", opt.short, opt.long)
+		}
+
+		if opt.arg != "" {
+			name += "=" + opt.arg
+		}
+
+		fmt.Fprintf(w, "  %-22s%s\n", name, opt.usage)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "With no FILE, or when FILE is -, read standard input.")
+}
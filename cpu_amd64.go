@@ -0,0 +1,122 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+// +build amd64,!gccgo,!appengine,!purego
+
+package base64
+
+// level is the set of instruction set extensions supported by the CPU.
+type level uint8
+
+const (
+	levelSSE2 level = iota // supported by every amd64 CPU
+	levelSSSE3
+	levelSSE41
+	levelAVX
+	levelAVX2
+)
+
+var levelNames = [...]string{
+	levelSSE2:  "SSE2",
+	levelSSSE3: "SSSE3",
+	levelSSE41: "SSE4.1",
+	levelAVX:   "AVX",
+	levelAVX2:  "AVX2",
+}
+
+func (l level) String() string {
+	return levelNames[l]
+}
+
+// loop is the widest loop that encodeASM or decodeASM may use. The values
+// are compared by the generated assembly and must match asm_gen.go.
+type loop uint8
+
+const (
+	loopScalar loop = iota
+	loopSSE
+	loopAVX
+	loopAVX2
+)
+
+// loops selects the loops that encodeASM and decodeASM use for each level.
+//
+// The SSE loop of encodeASM requires pshufb from SSSE3. The 128-bit loop
+// of decodeASM uses VEX-encoded instructions so requires AVX. Neither
+// makes use of SSE4.1.
+var loops = [...]struct {
+	encode, decode loop
+}{
+	levelSSE2:  {loopScalar, loopScalar},
+	levelSSSE3: {loopSSE, loopScalar},
+	levelSSE41: {loopSSE, loopScalar},
+	levelAVX:   {loopAVX, loopAVX},
+	levelAVX2:  {loopAVX2, loopAVX2},
+}
+
+// encodeLoop and decodeLoop are read by encodeASM and decodeASM.
+var encodeLoop, decodeLoop loop
+
+var cpuLevel level
+
+func init() {
+	cpuLevel = detectLevel()
+	setLevel(cpuLevel)
+}
+
+func setLevel(l level) {
+	encodeLoop, decodeLoop = loops[l].encode, loops[l].decode
+}
+
+// detectLevel uses cpuid to determine the level supported by the CPU. AVX
+// and AVX2 also require that the operating system saves the ymm registers.
+func detectLevel() level {
+	maxID, _, _, _ := cpuid(0, 0)
+	if maxID < 1 {
+		return levelSSE2
+	}
+
+	_, _, ecx1, _ := cpuid(1, 0)
+
+	const (
+		ssse3   = 1 << 9
+		sse41   = 1 << 19
+		osxsave = 1 << 27
+		avx     = 1 << 28
+
+		avx2 = 1 << 5
+	)
+
+	switch {
+	case ecx1&ssse3 == 0:
+		return levelSSE2
+	case ecx1&sse41 == 0:
+		return levelSSSE3
+	case ecx1&(osxsave|avx) != osxsave|avx:
+		return levelSSE41
+	}
+
+	// The OS must have enabled saving of the xmm (bit 1) and
+	// ymm (bit 2) registers.
+	if eax, _ := xgetbv(); eax&6 != 6 {
+		return levelSSE41
+	}
+
+	if maxID < 7 {
+		return levelAVX
+	}
+
+	if _, ebx7, _, _ := cpuid(7, 0); ebx7&avx2 == 0 {
+		return levelAVX
+	}
+
+	return levelAVX2
+}
+
+// This function is implemented in cpu_amd64.s
+func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+
+// This function is implemented in cpu_amd64.s
+func xgetbv() (eax, edx uint32)
@@ -0,0 +1,157 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+// +build amd64,!gccgo,!appengine,!purego
+
+package base64
+
+import (
+	"math/rand"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLevels(t *testing.T) {
+	defer setLevel(cpuLevel)
+
+	t.Logf("detected %s", cpuLevel)
+
+	for l := levelSSE2; l <= cpuLevel; l++ {
+		setLevel(l)
+
+		t.Run(l.String(), func(t *testing.T) {
+			t.Run("Encode", TestEncode)
+			t.Run("EncodeAlphabets", TestEncodeAlphabets)
+			t.Run("Decode", TestDecode)
+			t.Run("DecodeLengths", TestDecodeLengths)
+			t.Run("DecodeInvalid", TestDecodeInvalid)
+			t.Run("DecodeStrict", TestDecodeStrict)
+			t.Run("DecodeIgnore", TestDecodeIgnore)
+			t.Run("AnyEncoding", TestAnyEncoding)
+			t.Run("AnyEncodingInvalid", TestAnyEncodingInvalid)
+			t.Run("Valid", TestValid)
+			t.Run("ValidPrefix", TestValidPrefix)
+			t.Run("EncodeParallel", TestEncodeParallel)
+			t.Run("DecodeParallel", TestDecodeParallel)
+			t.Run("Bounds", TestBounds)
+			t.Run("GuardPage", TestGuardPage)
+		})
+	}
+}
+
+// withAsmChunk runs fn with the assembly called for chunk bytes of input
+// at a time.
+func withAsmChunk(chunk int, fn func()) {
+	defer func(chunk int) {
+		asmChunk = chunk
+	}(asmChunk)
+
+	asmChunk = chunk
+	fn()
+}
+
+func TestAsmChunks(t *testing.T) {
+	for _, chunk := range []int{4, 16, 64} {
+		withAsmChunk(chunk, func() {
+			t.Run(strconv.Itoa(chunk), func(t *testing.T) {
+				t.Run("Encode", TestEncode)
+				t.Run("Decode", TestDecode)
+				t.Run("DecodeLengths", TestDecodeLengths)
+				t.Run("DecodeInvalid", TestDecodeInvalid)
+				t.Run("AnyEncoding", TestAnyEncoding)
+				t.Run("Valid", TestValid)
+			})
+		})
+	}
+}
+
+// TestPreemptible checks that a huge Encode does not hold up a
+// stop-the-world pause, which runtime.ReadMemStats needs, until it returns.
+func TestPreemptible(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(2))
+
+	src := make([]byte, 128*1024*1024)
+	dst := make([]byte, StdEncoding.EncodedLen(len(src)))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		StdEncoding.Encode(dst, src)
+	}()
+
+	var ms runtime.MemStats
+	var worst time.Duration
+
+	for {
+		select {
+		case <-done:
+			// Without chunking the pause lasts about as long as the
+			// Encode, which is tens of milliseconds.
+			if worst > 20*time.Millisecond {
+				t.Errorf("stop-the-world took %v during Encode", worst)
+			}
+
+			return
+		default:
+		}
+
+		start := time.Now()
+		runtime.ReadMemStats(&ms)
+
+		if d := time.Since(start); d > worst {
+			worst = d
+		}
+	}
+}
+
+// BenchmarkAsmChunks compares Encode and Decode with and without the
+// assembly being called in chunks. Input of up to asmChunk characters is
+// never split, so the small sizes show the cost of the check alone.
+func BenchmarkAsmChunks(b *testing.B) {
+	for _, chunk := range []struct {
+		name string
+		l    int
+	}{
+		{"Chunked", asmChunk},
+		{"Unchunked", 1 << 40},
+	} {
+		for _, size := range []size{
+			{"32", 32},
+			{"1K", 1024},
+			{"64K", 64 * 1024},
+			{"16M", 16 * 1024 * 1024},
+		} {
+			data := make([]byte, size.l)
+			rand.Read(data)
+
+			src := make([]byte, StdEncoding.EncodedLen(size.l))
+			StdEncoding.Encode(src, data)
+
+			withAsmChunk(chunk.l, func() {
+				b.Run(chunk.name+"/Encode/"+size.name, func(b *testing.B) {
+					b.SetBytes(int64(size.l))
+
+					for i := 0; i < b.N; i++ {
+						StdEncoding.Encode(src, data)
+					}
+				})
+
+				b.Run(chunk.name+"/Decode/"+size.name, func(b *testing.B) {
+					b.SetBytes(int64(len(src)))
+
+					for i := 0; i < b.N; i++ {
+						StdEncoding.Decode(data, src)
+					}
+				})
+			})
+		}
+	}
+}
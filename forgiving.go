@@ -0,0 +1,74 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package base64
+
+// asciiWhitespace is ASCII whitespace as defined by the WHATWG Infra
+// Standard: TAB, LF, FF, CR and SPACE.
+const asciiWhitespace = "\t\n\f\r "
+
+// forgivingEncoding decodes what remains of the input once any trailing
+// padding has been removed.
+var forgivingEncoding = RawStdEncoding.WithIgnore(asciiWhitespace)
+
+// ForgivingDecode decodes src with the forgiving-base64 decode algorithm of
+// the WHATWG Infra Standard, which is used by atob in web browsers. ASCII
+// whitespace is skipped, padding is optional but must be complete if
+// present, and non-zero trailing bits are ignored. It writes at most
+// RawStdEncoding.DecodedLen(len(src)) bytes to dst and otherwise behaves
+// as Decode does.
+//
+// The matching encoder, btoa, is StdEncoding.
+func ForgivingDecode(dst, src []byte) (n int, err error) {
+	// 1. Remove all ASCII whitespace from data.
+	//
+	// The whitespace is skipped by forgivingEncoding instead.
+
+	// 2. If data's code point length divides by 4 leaving no remainder,
+	// then: if data ends with one or two U+003D (=) code points, then
+	// remove them from data.
+	//
+	// Up to two trailing '=' are removed here, and the length of what
+	// remains is checked once it has been decoded. If any '=' remain,
+	// they are rejected as invalid characters by step 4.
+	end, pad := len(src), 0
+	for i := len(src) - 1; i >= 0 && pad < 2; i-- {
+		if c := src[i]; c == '=' {
+			end, pad = i, pad+1
+		} else if !forgivingEncoding.ignores(c) {
+			break
+		}
+	}
+
+	// 3. If data's code point length divides by 4 leaving a remainder
+	// of 1, return failure.
+	//
+	// 4. If data contains a code point that is not one of U+002B (+),
+	// U+002F (/) or ASCII alphanumeric, then return failure.
+	//
+	// 5-8. Decode data, discarding any trailing bits.
+	//
+	// A final quantum of a single character is rejected as truncated,
+	// and any other character as invalid, by forgivingEncoding.
+	if n, err = forgivingEncoding.Decode(dst, src[:end]); err != nil {
+		return n, err
+	}
+
+	// The padding was only removable by step 2 if it completed the
+	// final quantum, which decoded to n%3 bytes from n%3+1 characters.
+	if pad != 0 && n%3+1+pad != 4 {
+		return n, CorruptInputError{int64(end), '=', InvalidPadding}
+	}
+
+	return n, nil
+}
+
+// ForgivingDecodeString returns the bytes represented by the base64 string
+// s as decoded by ForgivingDecode.
+func ForgivingDecodeString(s string) ([]byte, error) {
+	dbuf := make([]byte, RawStdEncoding.DecodedLen(len(s)))
+	n, err := ForgivingDecode(dbuf, []byte(s))
+	return dbuf[:n], err
+}
@@ -0,0 +1,181 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package base64
+
+import (
+	"bytes"
+	ref "encoding/base64"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// refForgivingDecode follows the forgiving-base64 decode algorithm of the
+// WHATWG Infra Standard one step at a time.
+func refForgivingDecode(data string) ([]byte, bool) {
+	// 1. Remove all ASCII whitespace from data.
+	data = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(asciiWhitespace, r) {
+			return -1
+		}
+
+		return r
+	}, data)
+
+	// 2. If data's code point length divides by 4 leaving no remainder,
+	// then: if data ends with one or two U+003D (=) code points, then
+	// remove them from data.
+	if len(data)%4 == 0 {
+		if strings.HasSuffix(data, "==") {
+			data = data[:len(data)-2]
+		} else if strings.HasSuffix(data, "=") {
+			data = data[:len(data)-1]
+		}
+	}
+
+	// 3. If data's code point length divides by 4 leaving a remainder
+	// of 1, return failure.
+	if len(data)%4 == 1 {
+		return nil, false
+	}
+
+	// 4. If data contains a code point that is not one of U+002B (+),
+	// U+002F (/) or ASCII alphanumeric, then return failure.
+	for _, c := range []byte(data) {
+		if !strings.ContainsRune(encodeStd, rune(c)) {
+			return nil, false
+		}
+	}
+
+	// 5-8. Decode data, discarding any trailing bits.
+	out, err := ref.RawStdEncoding.DecodeString(data)
+	return out, err == nil
+}
+
+// forgivingTests are the examples of the web-platform-tests for atob.
+var forgivingTests = []struct {
+	src    string
+	expect string
+	ok     bool
+}{
+	{"", "", true},
+	{"abcd", "i\xb7\x1d", true},
+	{" abcd", "i\xb7\x1d", true},
+	{"abcd ", "i\xb7\x1d", true},
+	{" abcd===", "", false},
+	{"abcd=== ", "", false},
+	{"abcd ===", "", false},
+	{"a", "", false},
+	{"ab", "i", true},
+	{"abc", "i\xb7", true},
+	{"abcde", "", false},
+	{"\xf0\x90\x80\x80", "", false},
+	{"=", "", false},
+	{"==", "", false},
+	{"===", "", false},
+	{"====", "", false},
+	{"=====", "", false},
+	{"a=", "", false},
+	{"a==", "", false},
+	{"a===", "", false},
+	{"a====", "", false},
+	{"a=====", "", false},
+	{"ab=", "", false},
+	{"ab==", "i", true},
+	{"ab===", "", false},
+	{"ab====", "", false},
+	{"ab=====", "", false},
+	{"abc=", "i\xb7", true},
+	{"abc==", "", false},
+	{"abc===", "", false},
+	{"abc====", "", false},
+	{"abc=====", "", false},
+	{"abcd=", "", false},
+	{"abcd==", "", false},
+	{"abcd===", "", false},
+	{"abcd====", "", false},
+	{"abcd=====", "", false},
+	{"abcde=", "", false},
+	{"abcde==", "", false},
+	{"abcde===", "", false},
+	{"abcde====", "", false},
+	{"abcde=====", "", false},
+	{"=a", "", false},
+	{"=a=", "", false},
+	{"a=b", "", false},
+	{"a=b=", "", false},
+	{"ab=c", "", false},
+	{"ab=c=", "", false},
+	{"abc=d", "", false},
+	{"abc=d=", "", false},
+	{"ab\tcd", "i\xb7\x1d", true},
+	{"ab\ncd", "i\xb7\x1d", true},
+	{"ab\fcd", "i\xb7\x1d", true},
+	{"ab\rcd", "i\xb7\x1d", true},
+	{"ab cd", "i\xb7\x1d", true},
+	{"ab\xc2\xa0cd", "", false},
+	{"ab\t\n\f\r cd", "i\xb7\x1d", true},
+	{" \t\n\f\r ab\t\n\f\r cd\t\n\f\r ", "i\xb7\x1d", true},
+	{"ab\t\n\f\r =\t\n\f\r =\t\n\f\r ", "i", true},
+	{"A", "", false},
+	{"/A", "\xfc", true},
+	{"//A", "\xff\xf0", true},
+	{"///A", "\xff\xff\xc0", true},
+	{"////A", "", false},
+	{"/", "", false},
+	{"A/", "\x03", true},
+	{"AA/", "\x00\x0f", true},
+	{"AAAA/", "", false},
+	{"AAA/", "\x00\x00\x3f", true},
+	{"\x00", "", false},
+	{"\x00nonsense", "", false},
+	{"abcd\x00nonsense", "", false},
+	{"YQ", "a", true},
+	{"YR", "a", true},
+	{"~~", "", false},
+	{"..", "", false},
+	{"--", "", false},
+	{"__", "", false},
+}
+
+func TestForgivingDecode(t *testing.T) {
+	for _, test := range forgivingTests {
+		got, err := ForgivingDecodeString(test.src)
+		if test.ok && (err != nil || string(got) != test.expect) {
+			t.Errorf("ForgivingDecodeString(%q) = %q, %v, expected %q, nil", test.src, got, err, test.expect)
+		} else if !test.ok && err == nil {
+			t.Errorf("ForgivingDecodeString(%q) = %q, nil, expected error", test.src, got)
+		}
+
+		if expect, ok := refForgivingDecode(test.src); ok != test.ok || string(expect) != test.expect {
+			t.Errorf("refForgivingDecode(%q) = %q, %t, expected %q, %t", test.src, expect, ok, test.expect, test.ok)
+		}
+	}
+}
+
+func TestForgivingDecodeRandom(t *testing.T) {
+	const chars = "AQgw+/=== \t\n\f\r*"
+
+	for i := 0; i < 100000; i++ {
+		src := make([]byte, rand.Intn(16))
+		for j := range src {
+			src[j] = chars[rand.Intn(len(chars))]
+		}
+
+		expect, ok := refForgivingDecode(string(src))
+
+		dst := make([]byte, RawStdEncoding.DecodedLen(len(src)))
+		n, err := ForgivingDecode(dst, src)
+
+		if ok != (err == nil) || ok && !bytes.Equal(dst[:n], expect) {
+			t.Fatalf("ForgivingDecode(%q) = %q, %v, expected %q, %t", src, dst[:n], err, expect, ok)
+		}
+
+		if _, isCorrupt := err.(CorruptInputError); err != nil && !isCorrupt {
+			t.Fatalf("ForgivingDecode(%q) returned %v, expected a CorruptInputError", src, err)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package base64
+
+import "errors"
+
+func guardedPage() ([]byte, func(), error) {
+	return nil, nil, errors.New("guard pages are not supported")
+}
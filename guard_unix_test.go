@@ -0,0 +1,31 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package base64
+
+import (
+	"os"
+	"syscall"
+)
+
+// guardedPage returns a page of memory that is followed by a page that
+// may be neither read nor written, and a function that unmaps both.
+func guardedPage() ([]byte, func(), error) {
+	size := os.Getpagesize()
+
+	mem, err := syscall.Mmap(-1, 0, 2*size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := syscall.Mprotect(mem[size:], syscall.PROT_NONE); err != nil {
+		syscall.Munmap(mem)
+		return nil, nil, err
+	}
+
+	return mem[:size:size], func() { syscall.Munmap(mem) }, nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package base64
+
+import (
+	"io"
+	"runtime"
+	"sync"
+)
+
+// parallelChunk is the least input that EncodeParallel and DecodeParallel
+// give each goroutine.
+var parallelChunk = 1 << 20
+
+// parallelism returns the number of goroutines to use for n bytes of
+// input, which is at most GOMAXPROCS.
+func parallelism(n int) int {
+	p := runtime.GOMAXPROCS(0)
+	if m := n / parallelChunk; m < p {
+		p = m
+	}
+
+	return p
+}
+
+// parallel splits [0, n) into at most p chunks, each of which but the last
+// is a multiple of unit bytes long, and calls fn for each chunk on its own
+// goroutine.
+func parallel(n, unit, p int, fn func(start, end int)) {
+	size := (n/p + unit - 1) / unit * unit
+
+	var wg sync.WaitGroup
+	for start := 0; start < n; start += size {
+		end := start + size
+		if end > n {
+			end = n
+		}
+
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			fn(start, end)
+		}(start, end)
+	}
+
+	wg.Wait()
+}
+
+// EncodeParallel is like Encode but, for large inputs, encodes src on up
+// to GOMAXPROCS goroutines. Each encodes a chunk of src straight into its
+// place in dst.
+func (enc Encoding) EncodeParallel(dst, src []byte) {
+	p := parallelism(len(src))
+	if p < 2 {
+		enc.Encode(dst, src)
+		return
+	}
+
+	if len(dst) < enc.EncodedLen(len(src)) {
+		panic("go-base64: output buffer too short")
+	}
+
+	// Each chunk is a whole number of quanta, or of lines if enc wraps
+	// lines, so only the last may be padded. Each chunk after the first
+	// begins with the separator that follows the line before it.
+	unit, out := 3, 4
+	if enc.lineWidth != 0 {
+		unit, out = enc.lineWidth/4*3, enc.lineWidth+len(enc.lineSep)
+	}
+
+	parallel(len(src), unit, p, func(start, end int) {
+		off, col := start/unit*out, 0
+		if start != 0 && enc.lineWidth != 0 {
+			off, col = off-len(enc.lineSep), enc.lineWidth
+		}
+
+		enc.encodeLines(dst[off:], src[start:end], col)
+	})
+}
+
+// DecodeParallel is like Decode but, for large inputs, decodes src on up
+// to GOMAXPROCS goroutines. Each decodes a chunk of src straight into its
+// place in dst. Input that contains padding before the final quantum,
+// ignored bytes, lines that are not wrapped as expected or invalid
+// characters is decoded by Decode from the first chunk that contains
+// them, so it returns the same results and errors as Decode. Bytes of dst
+// past those returned may have been overwritten.
+func (enc Encoding) DecodeParallel(dst, src []byte) (n int, err error) {
+	// Each chunk is a whole number of quanta, or of lines and the
+	// separators that follow them if enc wraps lines. The last quantum,
+	// or line, which may be padded, is always decoded by Decode.
+	unit, out, limit := 4, 3, (len(src)-1)&^3
+	if enc.lineWidth != 0 {
+		unit, out = enc.lineWidth+len(enc.lineSep), enc.lineWidth/4*3
+		_, limit, _ = enc.lastLine(src)
+	}
+
+	p := parallelism(limit)
+	if p < 2 {
+		return enc.Decode(dst, src)
+	}
+
+	if len(dst) < enc.decodedLen(src) {
+		return 0, io.ErrShortBuffer
+	}
+
+	var mu sync.Mutex
+	resume := limit
+
+	parallel(limit, unit, p, func(start, end int) {
+		if enc.decodeChunk(dst[start/unit*out:end/unit*out], src[start:end]) {
+			return
+		}
+
+		mu.Lock()
+		if start < resume {
+			resume = start
+		}
+		mu.Unlock()
+	})
+
+	n = resume / unit * out
+
+	if len(dst)-n < enc.decodedLen(src[resume:]) {
+		// The lines that follow are wrapped differently, so they
+		// are bounded as if enc did not wrap lines. Only the whole
+		// of src is certain to fit in dst.
+		resume, n = 0, 0
+	}
+
+	nn, err := enc.Decode(dst[n:], src[resume:])
+	if e, ok := err.(CorruptInputError); ok {
+		e.Offset += int64(resume)
+		err = e
+	}
+
+	return n + nn, err
+}
+
+// decodeChunk decodes src, which is a whole number of quanta, or of lines
+// and the separators that follow them if enc wraps lines, into dst. It
+// reports whether src only contained characters in the alphabet and, if
+// enc wraps lines, separators where they are expected. dst is never
+// written past the output for src.
+func (enc Encoding) decodeChunk(dst, src []byte) bool {
+	if enc.lineWidth == 0 {
+		_, ok := enc.decode(dst, src)
+		return ok
+	}
+
+	for off := 0; off < len(src); off += enc.lineWidth + len(enc.lineSep) {
+		_, ok := enc.decode(dst, src[off:off+enc.lineWidth])
+		if !ok || !hasPrefix(src[off+enc.lineWidth:], enc.lineSep) {
+			return false
+		}
+
+		dst = dst[enc.lineWidth/4*3:]
+	}
+
+	return true
+}
@@ -0,0 +1,135 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package base64
+
+import (
+	"bytes"
+	ref "encoding/base64"
+	"math/rand"
+	"runtime"
+	"testing"
+)
+
+// withParallelism runs fn with small chunks and more goroutines than
+// there may be CPUs, so that short inputs are split at many offsets.
+func withParallelism(fn func()) {
+	defer func(chunk, procs int) {
+		parallelChunk = chunk
+		runtime.GOMAXPROCS(procs)
+	}(parallelChunk, runtime.GOMAXPROCS(7))
+
+	parallelChunk = 16
+	fn()
+}
+
+func parallelEncodings(enc Encoding) []Encoding {
+	return []Encoding{
+		enc,
+		enc.WithLineWrap(8, "\r\n"),
+		enc.WithLineWrap(76, "\n"),
+	}
+}
+
+func TestEncodeParallel(t *testing.T) {
+	withParallelism(func() {
+		for _, e := range encodings {
+			for _, enc := range parallelEncodings(e.enc) {
+				for l := 0; l < 1024; l += 1 + rand.Intn(16) {
+					data := make([]byte, l)
+					rand.Read(data)
+
+					expect := make([]byte, enc.EncodedLen(l))
+					enc.Encode(expect, data)
+
+					buf := make([]byte, len(expect)+32)
+					canary(buf)
+
+					enc.EncodeParallel(buf[:len(expect)], data)
+
+					if !bytes.Equal(buf[:len(expect)], expect) {
+						t.Fatalf("%s: EncodeParallel(%x) = %q, expected %q", e.name, data, buf[:len(expect)], expect)
+					}
+
+					checkCanary(t, buf[len(expect):], "%s: EncodeParallel(%x)", e.name, data)
+				}
+			}
+		}
+	})
+}
+
+func TestDecodeParallel(t *testing.T) {
+	withParallelism(func() {
+		for _, e := range encodings {
+			for _, enc := range parallelEncodings(e.enc) {
+				for l := 0; l < 1024; l += 1 + rand.Intn(16) {
+					data := make([]byte, l)
+					rand.Read(data)
+					src := []byte(enc.EncodeToString(data))
+
+					for i := 0; i < 4; i++ {
+						bad := append([]byte(nil), src...)
+						if i != 0 && len(bad) != 0 {
+							bad[rand.Intn(len(bad))] = "=*\n."[rand.Intn(4)]
+						}
+
+						expect := make([]byte, enc.DecodedLen(len(bad)))
+						en, eerr := enc.Decode(expect, bad)
+
+						buf := make([]byte, enc.DecodedLen(len(bad))+32)
+						canary(buf)
+
+						dst := buf[:enc.DecodedLenExact(bad)]
+						n, err := enc.DecodeParallel(dst, bad)
+
+						if n != en || err != eerr || !bytes.Equal(dst[:n], expect[:en]) {
+							t.Fatalf("%s: DecodeParallel(%q) = %d, %v (%x), expected %d, %v (%x)",
+								e.name, bad, n, err, dst[:n], en, eerr, expect[:en])
+						}
+
+						checkCanary(t, buf[len(dst):], "%s: DecodeParallel(%q)", e.name, bad)
+					}
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkEncodeParallel(b *testing.B) {
+	for _, size := range sizes {
+		b.Run(size.name, func(b *testing.B) {
+			src := make([]byte, size.l)
+			rand.Read(src)
+
+			dst := make([]byte, StdEncoding.EncodedLen(size.l))
+
+			b.SetBytes(int64(size.l))
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				StdEncoding.EncodeParallel(dst, src)
+			}
+		})
+	}
+}
+
+func BenchmarkDecodeParallel(b *testing.B) {
+	for _, size := range sizes {
+		b.Run(size.name, func(b *testing.B) {
+			data := make([]byte, size.l)
+			rand.Read(data)
+
+			src := []byte(ref.StdEncoding.EncodeToString(data))
+			dst := make([]byte, StdEncoding.DecodedLen(len(src)))
+
+			b.SetBytes(int64(len(src)))
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				StdEncoding.DecodeParallel(dst, src)
+			}
+		})
+	}
+}
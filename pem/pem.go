@@ -0,0 +1,302 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+//
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pem implements the PEM data encoding, which originated in Privacy
+// Enhanced Mail, as encoding/pem does, but using go-base64.
+//
+// The base64 body of a block is decoded in place, skipping spaces, tabs and
+// line breaks as it goes, and is encoded with the line wrapping encoder.
+package pem
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/tmthrgd/go-base64"
+)
+
+// A Block represents a PEM encoded structure. It has the same fields as the
+// Block type of encoding/pem and may be converted to and from it.
+//
+// The encoded form is:
+//
+//	-----BEGIN Type-----
+//	Headers
+//	base64-encoded Bytes
+//	-----END Type-----
+//
+// where Headers is a possibly empty sequence of Key: Value lines.
+type Block struct {
+	Type    string            // The type, taken from the preamble (i.e. "RSA PRIVATE KEY").
+	Headers map[string]string // Optional headers.
+	Bytes   []byte            // The decoded bytes of the contents. Typically a DER encoded ASN.1 structure.
+}
+
+const pemLineLength = 64
+
+var (
+	// decodeEncoding skips the same bytes that encoding/pem does.
+	decodeEncoding = base64.StdEncoding.WithIgnore(" \t\r\n")
+
+	encodeEncoding = base64.StdEncoding.WithLineWrap(pemLineLength, "\n")
+)
+
+// getLine results the first \r\n or \n delineated line from the given byte
+// array. The line does not include trailing whitespace or the trailing new
+// line bytes. The remainder of the byte array (also not including the new line
+// bytes) is also returned and this will always be smaller than the original
+// argument.
+func getLine(data []byte) (line, rest []byte, consumed int) {
+	i := bytes.IndexByte(data, '\n')
+	var j int
+	if i < 0 {
+		i = len(data)
+		j = i
+	} else {
+		j = i + 1
+		if i > 0 && data[i-1] == '\r' {
+			i--
+		}
+	}
+	return bytes.TrimRight(data[0:i], " \t"), data[j:], j
+}
+
+// lastIndex is bytes.LastIndex, but searches forwards with bytes.Index,
+// which is much faster as it uses vector instructions.
+func lastIndex(s, sep []byte) int {
+	last := -1
+	for i := 0; ; {
+		j := bytes.Index(s[i:], sep)
+		if j < 0 {
+			return last
+		}
+
+		last = i + j
+		i = last + 1
+	}
+}
+
+var pemStart = []byte("\n-----BEGIN ")
+var pemEnd = []byte("\n-----END ")
+var pemEndOfLine = []byte("-----")
+
+// Decode will find the next PEM formatted block (certificate, private key
+// etc) in the input. It returns that block and the remainder of the input. If
+// no PEM data is found, p is nil and the whole of the input is returned in
+// rest. Blocks must start at the beginning of a line and end at the end of a line.
+func Decode(data []byte) (p *Block, rest []byte) {
+	// pemStart begins with a newline. However, at the very beginning of
+	// the byte array, we'll accept the start string without it.
+	rest = data
+
+	endTrailerIndex := 0
+	for {
+		// If we've already tried parsing a block, skip past the END we already
+		// saw.
+		if endTrailerIndex < 0 || endTrailerIndex > len(rest) {
+			return nil, data
+		}
+		rest = rest[endTrailerIndex:]
+
+		// Find the first END line, and then find the last BEGIN line before
+		// the end line. This lets us skip any repeated BEGIN lines that don't
+		// have a matching END.
+		endIndex := bytes.Index(rest, pemEnd)
+		if endIndex < 0 {
+			return nil, data
+		}
+		endTrailerIndex = endIndex + len(pemEnd)
+		beginIndex := lastIndex(rest[:endIndex], pemStart[1:])
+		if beginIndex < 0 || (beginIndex > 0 && rest[beginIndex-1] != '\n') {
+			continue
+		}
+		rest = rest[beginIndex+len(pemStart)-1:]
+		endIndex -= beginIndex + len(pemStart) - 1
+		endTrailerIndex -= beginIndex + len(pemStart) - 1
+
+		var typeLine []byte
+		var consumed int
+		typeLine, rest, consumed = getLine(rest)
+		endIndex -= consumed
+		endTrailerIndex -= consumed
+		if !bytes.HasSuffix(typeLine, pemEndOfLine) {
+			continue
+		}
+		typeLine = typeLine[0 : len(typeLine)-len(pemEndOfLine)]
+
+		p = &Block{
+			Headers: make(map[string]string),
+			Type:    string(typeLine),
+		}
+
+		for {
+			// This loop terminates because getLine's second result is
+			// always smaller than its argument.
+			if len(rest) == 0 {
+				return nil, data
+			}
+			line, next, consumed := getLine(rest)
+
+			i := bytes.IndexByte(line, ':')
+			if i < 0 {
+				break
+			}
+
+			// TODO(agl): need to cope with values that spread across lines.
+			key, val := bytes.TrimSpace(line[:i]), bytes.TrimSpace(line[i+1:])
+			p.Headers[string(key)] = string(val)
+			rest = next
+			endIndex -= consumed
+			endTrailerIndex -= consumed
+		}
+
+		// If there were headers, there must be a newline between the headers
+		// and the END line, so endIndex should be >= 0.
+		if len(p.Headers) > 0 && endIndex < 0 {
+			continue
+		}
+
+		// After the "-----" of the ending line, there should be the same type
+		// and then a final five dashes.
+		endTrailer := rest[endTrailerIndex:]
+		endTrailerLen := len(typeLine) + len(pemEndOfLine)
+		if len(endTrailer) < endTrailerLen {
+			continue
+		}
+
+		restOfEndLine := endTrailer[endTrailerLen:]
+		endTrailer = endTrailer[:endTrailerLen]
+		if !bytes.HasPrefix(endTrailer, typeLine) ||
+			!bytes.HasSuffix(endTrailer, pemEndOfLine) {
+			continue
+		}
+
+		// The line must end with only whitespace.
+		if s, _, _ := getLine(restOfEndLine); len(s) != 0 {
+			continue
+		}
+
+		p.Bytes = []byte{}
+		if endIndex > 0 {
+			// Spaces, tabs and newlines are skipped by the decoder,
+			// so the body is decoded without first being copied.
+			base64Data := rest[:endIndex]
+			p.Bytes = make([]byte, decodeEncoding.DecodedLen(len(base64Data)))
+			n, err := decodeEncoding.Decode(p.Bytes, base64Data)
+			if err != nil {
+				continue
+			}
+			p.Bytes = p.Bytes[:n]
+		}
+
+		// the -1 is because we might have only matched pemEnd without the
+		// leading newline if the PEM block was empty.
+		_, rest, _ = getLine(rest[endIndex+len(pemEnd)-1:])
+		return p, rest
+	}
+}
+
+// DecodeAll decodes every PEM block in data, as if by calling Decode until
+// it returns nil. It returns the blocks and the input that follows the
+// last of them.
+func DecodeAll(data []byte) (blocks []*Block, rest []byte) {
+	for rest = data; ; {
+		p, next := Decode(rest)
+		if p == nil {
+			return blocks, rest
+		}
+
+		blocks = append(blocks, p)
+		rest = next
+	}
+}
+
+// Encode writes the PEM encoding of b to out.
+func Encode(out io.Writer, b *Block) error {
+	buf, err := appendBlock(nil, b)
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(buf)
+	return err
+}
+
+// EncodeToMemory returns the PEM encoding of b.
+//
+// If b has invalid headers and cannot be encoded,
+// EncodeToMemory returns nil. If it is important to
+// report details about this error case, use Encode instead.
+func EncodeToMemory(b *Block) []byte {
+	buf, err := appendBlock(nil, b)
+	if err != nil {
+		return nil
+	}
+
+	return buf
+}
+
+// appendBlock appends the PEM encoding of b to dst. The base64 body is
+// encoded into dst directly with one call to AppendEncode.
+func appendBlock(dst []byte, b *Block) ([]byte, error) {
+	// Check for invalid block before writing any output.
+	for k := range b.Headers {
+		if strings.Contains(k, ":") {
+			return nil, errors.New("pem: cannot encode a header key that contains a colon")
+		}
+	}
+
+	dst = append(dst, pemStart[1:]...)
+	dst = append(dst, b.Type...)
+	dst = append(dst, "-----\n"...)
+
+	if len(b.Headers) > 0 {
+		const procType = "Proc-Type"
+		h := make([]string, 0, len(b.Headers))
+		hasProcType := false
+		for k := range b.Headers {
+			if k == procType {
+				hasProcType = true
+				continue
+			}
+			h = append(h, k)
+		}
+		// The Proc-Type header must be written first.
+		// See RFC 1421, section 4.6.1.1
+		if hasProcType {
+			dst = appendHeader(dst, procType, b.Headers[procType])
+		}
+		// For consistency of output, write other headers sorted by key.
+		sort.Strings(h)
+		for _, k := range h {
+			dst = appendHeader(dst, k, b.Headers[k])
+		}
+		dst = append(dst, '\n')
+	}
+
+	if len(b.Bytes) > 0 {
+		// encodeEncoding does not write a newline after the last line.
+		dst = encodeEncoding.AppendEncode(dst, b.Bytes)
+		dst = append(dst, '\n')
+	}
+
+	dst = append(dst, pemEnd[1:]...)
+	dst = append(dst, b.Type...)
+	return append(dst, "-----\n"...), nil
+}
+
+func appendHeader(dst []byte, k, v string) []byte {
+	dst = append(dst, k...)
+	dst = append(dst, ": "...)
+	dst = append(dst, v...)
+	return append(dst, '\n')
+}
@@ -0,0 +1,198 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package pem
+
+import (
+	"bytes"
+	ref "encoding/pem"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func randomBlock(rnd *rand.Rand, size int) *Block {
+	b := &Block{Type: "TEST " + strconv.Itoa(size), Bytes: make([]byte, size)}
+	rnd.Read(b.Bytes)
+
+	if size%3 == 0 {
+		b.Headers = map[string]string{
+			"Proc-Type": "4,ENCRYPTED",
+			"DEK-Info":  "DES-EDE3-CBC," + strconv.Itoa(size),
+		}
+	}
+
+	return b
+}
+
+// sameBlock reports whether p was decoded as expect was by encoding/pem.
+func sameBlock(p *Block, expect *ref.Block) bool {
+	if p == nil || expect == nil {
+		return p == nil && expect == nil
+	}
+
+	return reflect.DeepEqual((*ref.Block)(p), expect)
+}
+
+func TestEncode(t *testing.T) {
+	rnd := rand.New(rand.NewSource(0))
+
+	for size := 0; size < 300; size++ {
+		b := randomBlock(rnd, size)
+		expect := ref.EncodeToMemory((*ref.Block)(b))
+
+		if got := EncodeToMemory(b); !bytes.Equal(got, expect) {
+			t.Fatalf("EncodeToMemory(%d bytes) = %q, expected %q", size, got, expect)
+		}
+
+		var buf bytes.Buffer
+		if err := Encode(&buf, b); err != nil || !bytes.Equal(buf.Bytes(), expect) {
+			t.Fatalf("Encode(%d bytes) = %q, %v, expected %q, nil", size, buf.Bytes(), err, expect)
+		}
+	}
+}
+
+func TestBadEncode(t *testing.T) {
+	b := &Block{Type: "BAD", Headers: map[string]string{"X:Y": "Z"}}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, b); err == nil || buf.Len() != 0 {
+		t.Fatalf("Encode wrote %q, %v, expected error", buf.Bytes(), err)
+	}
+
+	if data := EncodeToMemory(b); data != nil {
+		t.Fatalf("EncodeToMemory returned %q, expected nil", data)
+	}
+}
+
+// mangle returns variations of the PEM encoded data that encoding/pem
+// either accepts or rejects.
+func mangle(rnd *rand.Rand, data string) []string {
+	lines := strings.SplitAfter(data, "\n")
+
+	whitespace := make([]string, len(lines))
+	for i, line := range lines {
+		if i > 0 && i < len(lines)-2 && rnd.Intn(2) == 0 {
+			j := rnd.Intn(len(line))
+			line = line[:j] + []string{" ", "\t", "  \t"}[rnd.Intn(3)] + line[j:]
+		}
+
+		whitespace[i] = line
+	}
+
+	corrupt := []byte(data)
+	corrupt[len(data)/2] = '*'
+
+	return []string{
+		data,
+		strings.Replace(data, "\n", "\r\n", -1),
+		strings.Join(whitespace, ""),
+		string(corrupt),
+		"preamble\n" + data + "trailer",
+		data + data,
+		data[:len(data)-2],
+		strings.Replace(data, "=", "", -1),
+	}
+}
+
+func TestDecode(t *testing.T) {
+	rnd := rand.New(rand.NewSource(0))
+
+	for size := 0; size < 300; size++ {
+		data := string(EncodeToMemory(randomBlock(rnd, size)))
+
+		for _, src := range mangle(rnd, data) {
+			expect, erest := ref.Decode([]byte(src))
+
+			p, rest := Decode([]byte(src))
+			if !sameBlock(p, expect) || !bytes.Equal(rest, erest) {
+				t.Fatalf("Decode(%q) = %v, %q, expected %v, %q", src, p, rest, expect, erest)
+			}
+		}
+	}
+}
+
+func TestDecodeAll(t *testing.T) {
+	rnd := rand.New(rand.NewSource(0))
+
+	var buf bytes.Buffer
+	for size := 0; size < 100; size++ {
+		buf.WriteString("junk " + strconv.Itoa(size) + "\n")
+		Encode(&buf, randomBlock(rnd, size))
+	}
+
+	buf.WriteString("trailer")
+
+	blocks, rest := DecodeAll(buf.Bytes())
+	if len(blocks) != 100 || string(rest) != "trailer" {
+		t.Fatalf("DecodeAll returned %d blocks, %q, expected 100, %q", len(blocks), rest, "trailer")
+	}
+
+	for data := buf.Bytes(); len(blocks) > 0; blocks = blocks[1:] {
+		var expect *ref.Block
+		expect, data = ref.Decode(data)
+
+		if !sameBlock(blocks[0], expect) {
+			t.Fatalf("DecodeAll returned %v, expected %v", blocks[0], expect)
+		}
+	}
+
+	if blocks, rest := DecodeAll([]byte("no blocks")); blocks != nil || string(rest) != "no blocks" {
+		t.Fatalf("DecodeAll returned %v, %q, expected nil, %q", blocks, rest, "no blocks")
+	}
+}
+
+// bundle is a stand in for a CA bundle of 5,000 certificates.
+func bundle() []byte {
+	rnd := rand.New(rand.NewSource(0))
+
+	var buf bytes.Buffer
+	for i := 0; i < 5000; i++ {
+		Encode(&buf, &Block{Type: "CERTIFICATE", Bytes: randomBlock(rnd, 900+rnd.Intn(600)).Bytes})
+	}
+
+	return buf.Bytes()
+}
+
+func BenchmarkDecodeAll(b *testing.B) {
+	data := bundle()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		DecodeAll(data)
+	}
+}
+
+func BenchmarkRefDecodeAll(b *testing.B) {
+	data := bundle()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for p, rest := ref.Decode(data); p != nil; p, rest = ref.Decode(rest) {
+		}
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	block := &Block{Type: "CERTIFICATE", Bytes: make([]byte, 1200)}
+	b.SetBytes(int64(len(block.Bytes)))
+
+	for i := 0; i < b.N; i++ {
+		EncodeToMemory(block)
+	}
+}
+
+func BenchmarkRefEncode(b *testing.B) {
+	block := &ref.Block{Type: "CERTIFICATE", Bytes: make([]byte, 1200)}
+	b.SetBytes(int64(len(block.Bytes)))
+
+	for i := 0; i < b.N; i++ {
+		ref.EncodeToMemory(block)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package base64
+
+import (
+	"errors"
+	"io"
+)
+
+// decodeAtChunk is the most input that ReadAt reads from the underlying
+// io.ReaderAt at once.
+const decodeAtChunk = 8 * 1024
+
+// DecoderAt decodes byte ranges of base64 that is stored in an io.ReaderAt.
+// Every quantum before the last decodes to three bytes, so the bytes from
+// an offset are decoded from the quanta that hold them, without reading
+// those before. It is safe for concurrent use.
+type DecoderAt struct {
+	enc Encoding // decodes the quanta before the final quantum
+	r   io.ReaderAt
+
+	last int64 // offset in r of the final quantum
+
+	tail    [3]byte // the final quantum decoded
+	ntail   int     // number of bytes in tail
+	tailErr error   // error from decoding the final quantum
+}
+
+// NewDecoderAt returns a DecoderAt that decodes the size bytes of base64 in
+// r with enc, which must not wrap lines. Bytes that enc ignores, such as
+// line breaks, are not skipped but reported as a CorruptInputError, with
+// an offset relative to the start of r. The final quantum, which may be
+// padded, is read and decoded by NewDecoderAt.
+func NewDecoderAt(enc Encoding, r io.ReaderAt, size int64) *DecoderAt {
+	if enc.lineWidth != 0 {
+		panic("go-base64: NewDecoderAt does not support line wrapping")
+	}
+
+	if size < 0 {
+		panic("go-base64: negative size")
+	}
+
+	enc.ignore = ""
+
+	// Padding is only valid in the final quantum, so the quanta before it
+	// are decoded as if enc were unpadded.
+	raw := enc
+	raw.padding, raw.padOptional = NoPadding, false
+
+	d := &DecoderAt{enc: raw, r: r}
+	if size == 0 {
+		return d
+	}
+
+	d.last = (size - 1) &^ 3
+
+	var src [4]byte
+	if d.tailErr = d.read(src[:size-d.last], d.last); d.tailErr == nil {
+		d.ntail, d.tailErr = enc.Decode(d.tail[:], src[:size-d.last])
+		d.tailErr = d.corrupt(d.tailErr, d.last)
+	}
+
+	return d
+}
+
+// Size returns the length of the decoded data. If the final quantum could
+// not be read or is invalid, it is not counted and ReadAt returns the error
+// once it reaches it.
+func (d *DecoderAt) Size() int64 {
+	return d.last/4*3 + int64(d.ntail)
+}
+
+// ReadAt decodes len(p) bytes into p from offset off of the decoded data.
+// It implements io.ReaderAt, so it returns io.EOF if fewer than len(p)
+// bytes remain.
+func (d *DecoderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("go-base64: DecoderAt.ReadAt: negative offset")
+	}
+
+	interior := d.last / 4 * 3
+
+	var buf []byte
+	for len(p) != 0 && off < interior {
+		q := off / 3
+
+		if off%3 != 0 || len(p) < 3 {
+			// The range begins or ends within a quantum, so that
+			// quantum is decoded on its own.
+			var src [4]byte
+			var dst [3]byte
+			if err = d.decode(dst[:], src[:], q); err != nil {
+				return n, err
+			}
+
+			nn := copy(p, dst[off%3:])
+			n, off, p = n+nn, off+int64(nn), p[nn:]
+			continue
+		}
+
+		quanta := int64(len(p) / 3)
+		if quanta > interior/3-q {
+			quanta = interior/3 - q
+		}
+
+		if quanta > decodeAtChunk/4 {
+			quanta = decodeAtChunk / 4
+		}
+
+		if buf == nil {
+			buf = make([]byte, quanta*4)
+		}
+
+		if err = d.decode(p, buf[:quanta*4], q); err != nil {
+			return n, err
+		}
+
+		nn := int(quanta * 3)
+		n, off, p = n+nn, off+int64(nn), p[nn:]
+	}
+
+	if len(p) == 0 {
+		return n, nil
+	}
+
+	if off-interior < int64(d.ntail) {
+		nn := copy(p, d.tail[off-interior:d.ntail])
+		n, p = n+nn, p[nn:]
+	}
+
+	if len(p) == 0 {
+		return n, nil
+	}
+
+	if d.tailErr != nil {
+		return n, d.tailErr
+	}
+
+	return n, io.EOF
+}
+
+// decode reads len(src) bytes, which are whole quanta before the final
+// quantum, into src from the offset in r of quantum q and decodes them
+// into dst.
+func (d *DecoderAt) decode(dst, src []byte, q int64) error {
+	if err := d.read(src, q*4); err != nil {
+		return err
+	}
+
+	_, err := d.enc.Decode(dst, src)
+	return d.corrupt(err, q*4)
+}
+
+// read reads len(p) bytes into p from offset off of r. r is expected to
+// hold them, so a short read is an io.ErrUnexpectedEOF.
+func (d *DecoderAt) read(p []byte, off int64) error {
+	n, err := d.r.ReadAt(p, off)
+	if n == len(p) {
+		return nil
+	}
+
+	if err == io.EOF || err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+// corrupt converts an error returned from Decode on the input at offset
+// off of r into one relative to the start of r.
+func (d *DecoderAt) corrupt(err error, off int64) error {
+	if e, ok := err.(CorruptInputError); ok {
+		e.Offset += off
+		return e
+	}
+
+	return err
+}
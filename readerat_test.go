@@ -0,0 +1,133 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package base64
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDecoderAt(t *testing.T) {
+	for _, e := range encodings {
+		for _, l := range []int{0, 1, 2, 3, 4, 5, 16, 100, 1000, 3 * decodeAtChunk} {
+			data := make([]byte, l)
+			rand.Read(data)
+			src := e.enc.EncodeToString(data)
+
+			d := NewDecoderAt(e.enc, strings.NewReader(src), int64(len(src)))
+			if d.Size() != int64(l) {
+				t.Fatalf("%s: Size() of %q = %d, expected %d", e.name, src, d.Size(), l)
+			}
+
+			for i := 0; i < 100; i++ {
+				off, n := rand.Intn(l+2), rand.Intn(l+2)
+				if i < 3*4 {
+					off, n = i/4, i%4*(l/2)
+				}
+
+				buf := make([]byte, n+32)
+				canary(buf)
+
+				got, err := d.ReadAt(buf[:n], int64(off))
+
+				var expect []byte
+				if off < l {
+					expect = data[off:]
+				}
+
+				if n < len(expect) {
+					expect = expect[:n]
+				}
+
+				if got < n && err != io.EOF || got == n && err != nil || !bytes.Equal(buf[:got], expect) {
+					t.Fatalf("%s: ReadAt(%d, %d) of %q = %x, %v, expected %x", e.name, n, off, src, buf[:got], err, expect)
+				}
+
+				checkCanary(t, buf[n:], "%s: ReadAt(%d, %d) of %q", e.name, n, off, src)
+			}
+		}
+	}
+}
+
+func TestDecoderAtInvalid(t *testing.T) {
+	for _, test := range []struct {
+		enc    Encoding
+		src    string
+		off    int64
+		n      int
+		size   int64
+		offset int64
+	}{
+		{StdEncoding, "YWJjYW*jYWJj", 0, 9, 9, 6},
+		{StdEncoding, "YWJjYWJjYW*j", 3, 6, 6, 10},
+		{StdEncoding, "YQ==YWJjYWJj", 0, 9, 9, 2},
+		{StdEncoding, "YWJj\r\nYWJj", 0, 6, 6, 4},
+		{StdEncoding, "YWJjYWJjYQ=", 0, 7, 6, 11},
+		{StdEncoding.Strict(), "YWJjYWJjYR==", 6, 1, 6, 10},
+		{RawStdEncoding, "YWJjYWJjYQ==", 0, 9, 6, 10},
+		{RawStdEncoding, "YWJjYWJjY", 0, 7, 6, 8},
+		{AnyEncoding, "YWJjYW=jYWJj", 0, 9, 9, 6},
+	} {
+		d := NewDecoderAt(test.enc, strings.NewReader(test.src), int64(len(test.src)))
+		if d.Size() != test.size {
+			t.Errorf("Size() of %q = %d, expected %d", test.src, d.Size(), test.size)
+		}
+
+		_, err := d.ReadAt(make([]byte, test.n), test.off)
+		if e, ok := err.(CorruptInputError); !ok || e.Offset != test.offset {
+			t.Errorf("ReadAt(%d, %d) of %q returned %v, expected a CorruptInputError at %d", test.n, test.off, test.src, err, test.offset)
+		}
+	}
+}
+
+func TestDecoderAtReadError(t *testing.T) {
+	src := "YWJjYWJjYWJj"
+
+	d := NewDecoderAt(StdEncoding, strings.NewReader(src), int64(len(src))+4)
+	if _, err := d.ReadAt(make([]byte, 3), 0); err != nil {
+		t.Errorf("ReadAt before the end of r returned %v", err)
+	}
+
+	if _, err := d.ReadAt(make([]byte, 12), 0); err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadAt past the end of r returned %v, expected %v", err, io.ErrUnexpectedEOF)
+	}
+
+	d = NewDecoderAt(StdEncoding, errReaderAt{iotest.ErrTimeout}, int64(len(src)))
+	if _, err := d.ReadAt(make([]byte, 9), 0); err != iotest.ErrTimeout {
+		t.Errorf("ReadAt returned %v, expected %v", err, iotest.ErrTimeout)
+	}
+}
+
+type errReaderAt struct {
+	err error
+}
+
+func (r errReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	return 0, r.err
+}
+
+func BenchmarkDecoderAt(b *testing.B) {
+	for _, size := range sizes {
+		b.Run(size.name, func(b *testing.B) {
+			data := make([]byte, size.l)
+			rand.Read(data)
+
+			src := StdEncoding.EncodeToString(data)
+			d := NewDecoderAt(StdEncoding, strings.NewReader(src), int64(len(src)))
+
+			b.SetBytes(int64(size.l))
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				d.ReadAt(data, 0)
+			}
+		})
+	}
+}
@@ -0,0 +1,380 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+//
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package base64
+
+import (
+	"bytes"
+	"io"
+)
+
+// encodeChunk is the most that encoder and encodingReader encode at once.
+const encodeChunk = 12 * 1024
+
+type encoder struct {
+	err  error
+	enc  Encoding
+	w    io.Writer
+	buf  [3]byte // buffered data waiting to be encoded
+	nbuf int     // number of bytes in buf
+	col  int     // column of the next character if enc wraps lines
+	out  []byte
+}
+
+func (e *encoder) Write(p []byte) (n int, err error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+
+	// Leading fringe.
+	if e.nbuf > 0 {
+		var i int
+		for i = 0; i < len(p) && e.nbuf < 3; i++ {
+			e.buf[e.nbuf] = p[i]
+			e.nbuf++
+		}
+
+		n += i
+		p = p[i:]
+
+		if e.nbuf < 3 {
+			return
+		}
+
+		var nw int
+		nw, e.col = e.enc.encodeLines(e.out, e.buf[:], e.col)
+		if _, e.err = e.w.Write(e.out[:nw]); e.err != nil {
+			return n, e.err
+		}
+
+		e.nbuf = 0
+	}
+
+	// Large interior chunks.
+	for len(p) >= 3 {
+		nn := encodeChunk
+		if nn > len(p) {
+			nn = len(p)
+			nn -= nn % 3
+		}
+
+		var nw int
+		nw, e.col = e.enc.encodeLines(e.out, p[:nn], e.col)
+		if _, e.err = e.w.Write(e.out[:nw]); e.err != nil {
+			return n, e.err
+		}
+
+		n += nn
+		p = p[nn:]
+	}
+
+	// Trailing fringe.
+	copy(e.buf[:], p)
+	e.nbuf = len(p)
+	n += len(p)
+	return
+}
+
+// Close flushes any pending output from the encoder.
+// It is an error to call Write after calling Close.
+func (e *encoder) Close() error {
+	// If there's anything left in the buffer, flush it out
+	if e.err == nil && e.nbuf > 0 {
+		nw, _ := e.enc.encodeLines(e.out, e.buf[:e.nbuf], e.col)
+		_, e.err = e.w.Write(e.out[:nw])
+		e.nbuf = 0
+	}
+
+	return e.err
+}
+
+// NewEncoder returns a new base64 stream encoder. Data written to
+// the returned writer will be encoded using enc and then written to w.
+// Base64 encodings operate in 4-byte blocks; when finished
+// writing, the caller must Close the returned encoder to flush any
+// partially written blocks. If enc wraps lines, separators are written
+// as described by WithLineWrap.
+func NewEncoder(enc Encoding, w io.Writer) io.WriteCloser {
+	// A chunk that starts at the end of a line is preceded by
+	// one more separator than EncodedLen counts.
+	out := make([]byte, enc.EncodedLen(encodeChunk)+len(enc.lineSep))
+	return &encoder{enc: enc, w: w, out: out}
+}
+
+type encodingReader struct {
+	err error // error from r.Read
+	enc Encoding
+	r   io.Reader
+	in  [encodeChunk]byte // input read from r
+	nin int               // number of bytes in in
+	col int               // column of the next character if enc wraps lines
+	out []byte            // leftover encoded output
+	buf []byte
+}
+
+// fill reads from r and encodes the whole quanta in in, or all of in once
+// r returns io.EOF, into out.
+func (e *encodingReader) fill() {
+	var nr int
+	nr, e.err = e.r.Read(e.in[e.nin:])
+	e.nin += nr
+
+	nn := e.nin / 3 * 3
+	if e.err == io.EOF {
+		nn = e.nin
+	}
+
+	if nn == 0 {
+		return
+	}
+
+	var nw int
+	nw, e.col = e.enc.encodeLines(e.buf, e.in[:nn], e.col)
+	e.out = e.buf[:nw]
+
+	e.nin = copy(e.in[:], e.in[nn:e.nin])
+}
+
+func (e *encodingReader) Read(p []byte) (n int, err error) {
+	for len(e.out) == 0 {
+		if e.err != nil {
+			return 0, e.err
+		}
+
+		e.fill()
+	}
+
+	n = copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
+
+// WriteTo writes the encoding of r to w without copying it through an
+// intermediate buffer. It implements io.WriterTo.
+func (e *encodingReader) WriteTo(w io.Writer) (n int64, err error) {
+	for {
+		if len(e.out) != 0 {
+			nw, err := w.Write(e.out)
+			n += int64(nw)
+			e.out = e.out[nw:]
+
+			if err != nil {
+				return n, err
+			}
+		}
+
+		if e.err == io.EOF {
+			return n, nil
+		} else if e.err != nil {
+			return n, e.err
+		}
+
+		e.fill()
+	}
+}
+
+// NewEncodingReader returns a reader of the base64 encoding of r, as
+// NewEncoder would write it. It reads from r in blocks of whole quanta,
+// and the final partial quantum is encoded, with padding, when r returns
+// io.EOF. If enc wraps lines, separators are returned as described by
+// WithLineWrap. The returned reader also implements io.WriterTo.
+func NewEncodingReader(enc Encoding, r io.Reader) io.Reader {
+	// As for NewEncoder, a chunk that starts at the end of a line is
+	// preceded by one more separator than EncodedLen counts.
+	buf := make([]byte, enc.EncodedLen(encodeChunk)+len(enc.lineSep))
+	return &encodingReader{enc: enc, r: r, buf: buf}
+}
+
+type decoder struct {
+	err     error
+	readErr error    // error from r.Read
+	enc     Encoding // decodes raw, skipping the bytes in skip
+	r       io.Reader
+
+	skip  [256]bool // bytes that are removed from the input
+	skips []byte    // the bytes in skip
+
+	raw   [8 * 1024]byte // input read from r that is not yet decoded
+	nraw  int            // number of bytes in raw
+	nchar int            // number of bytes in raw that are not skipped
+	off   int64          // stream offset of raw[ncarry]
+
+	carry  [3]int64 // stream offsets of raw[:ncarry]
+	ncarry int      // number of bytes in raw read before raw[ncarry:]
+
+	out    []byte // leftover decoded output
+	outbuf [8 * 1024 / 4 * 3]byte
+}
+
+// offset returns the offset in the underlying stream of raw[i].
+func (d *decoder) offset(i int) int64 {
+	if i < d.ncarry {
+		return d.carry[i]
+	}
+
+	return d.off + int64(i-d.ncarry)
+}
+
+// setCarry moves the bytes of raw[i:nraw] that are not skipped, of which
+// there are fewer than four, to the front of raw and records their stream
+// offsets.
+func (d *decoder) setCarry(i int) {
+	var carry [3]int64
+	n := 0
+	for ; i < d.nraw; i++ {
+		if !d.skip[d.raw[i]] {
+			carry[n] = d.offset(i)
+			d.raw[n] = d.raw[i]
+			n++
+		}
+	}
+
+	d.off += int64(d.nraw - d.ncarry)
+	d.carry, d.ncarry, d.nraw = carry, n, n
+}
+
+// corrupt converts an error returned from Decode on raw into one
+// relative to the underlying stream.
+func (d *decoder) corrupt(err error) error {
+	if e, ok := err.(CorruptInputError); ok {
+		e.Offset = d.offset(int(e.Offset))
+		return e
+	}
+
+	return err
+}
+
+// fill reads from r into the rest of raw, and counts the bytes read that
+// are not skipped.
+func (d *decoder) fill(n int) {
+	if d.nraw == len(d.raw) {
+		// raw holds fewer than four characters between the skipped
+		// bytes, which are dropped to make room.
+		d.setCarry(0)
+	}
+
+	if n > len(d.raw)-d.nraw {
+		n = len(d.raw) - d.nraw
+	}
+
+	n, d.readErr = d.r.Read(d.raw[d.nraw : d.nraw+n])
+
+	p := d.raw[d.nraw : d.nraw+n]
+	d.nraw += n
+	d.nchar += n
+
+	for i := range d.skips {
+		d.nchar -= bytes.Count(p, d.skips[i:i+1])
+	}
+}
+
+// quanta returns the length of the prefix of raw that holds the whole
+// quanta, which is found by stepping back over the characters of the
+// final partial quantum.
+func (d *decoder) quanta() int {
+	i := d.nraw
+	for rem := d.nchar % 4; rem > 0; {
+		i--
+		if !d.skip[d.raw[i]] {
+			rem--
+		}
+	}
+
+	return i
+}
+
+func (d *decoder) Read(p []byte) (n int, err error) {
+	// Use leftover decoded output from last read.
+	if len(d.out) > 0 {
+		n = copy(p, d.out)
+		d.out = d.out[n:]
+		return n, nil
+	}
+
+	if d.err != nil {
+		return 0, d.err
+	}
+
+	// Refill buffer.
+	for d.nchar < 4 && d.readErr == nil {
+		nn := len(p) / 3 * 4
+		if nn < 4 {
+			nn = 4
+		}
+
+		d.fill(nn)
+	}
+
+	if d.nchar < 4 {
+		if (d.enc.padding == NoPadding || d.enc.padOptional) && d.nchar > 0 {
+			// Decode final fragment, without padding.
+			var nw int
+			nw, d.err = d.enc.Decode(d.outbuf[:], d.raw[:d.nraw])
+			d.err = d.corrupt(d.err)
+			d.nchar = 0
+			d.out = d.outbuf[:nw]
+			n = copy(p, d.out)
+			d.out = d.out[n:]
+
+			if n > 0 || len(p) == 0 && len(d.out) > 0 {
+				return n, nil
+			}
+
+			if d.err != nil {
+				return 0, d.err
+			}
+		}
+
+		d.err = d.readErr
+		if d.err == io.EOF && d.nchar > 0 {
+			d.err = io.ErrUnexpectedEOF
+		}
+
+		return 0, d.err
+	}
+
+	// Decode whole quanta into p, or d.out and then p if p is too small.
+	// Decode skips the bytes in skip itself, so raw is decoded in place.
+	nr := d.quanta()
+	if d.enc.decodedLen(d.raw[:nr]) > len(p) {
+		var nw int
+		nw, d.err = d.enc.Decode(d.outbuf[:], d.raw[:nr])
+		d.out = d.outbuf[:nw]
+		n = copy(p, d.out)
+		d.out = d.out[n:]
+	} else {
+		n, d.err = d.enc.Decode(p, d.raw[:nr])
+	}
+
+	d.err = d.corrupt(d.err)
+
+	d.nchar %= 4
+	d.setCarry(nr)
+	return n, d.err
+}
+
+// NewDecoder constructs a new base64 stream decoder. The bytes that enc
+// ignores, and the bytes of the line separator if enc wraps lines, are
+// skipped and the offsets of any CorruptInputError are relative to the
+// start of r.
+func NewDecoder(enc Encoding, r io.Reader) io.Reader {
+	d := &decoder{enc: enc.unwrapped(), r: r}
+
+	for _, s := range [...]string{enc.ignore, enc.lineSep} {
+		for i := 0; i < len(s); i++ {
+			if !d.skip[s[i]] {
+				d.skip[s[i]] = true
+				d.skips = append(d.skips, s[i])
+			}
+		}
+	}
+
+	d.enc.ignore = string(d.skips)
+	return d
+}
@@ -0,0 +1,346 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package base64
+
+import (
+	"bytes"
+	ref "encoding/base64"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestEncoder(t *testing.T) {
+	for _, e := range encodings {
+		t.Run(e.name, func(t *testing.T) {
+			for i := 0; i < 200; i++ {
+				data := make([]byte, rand.Intn(64*1024))
+				rand.Read(data)
+
+				var buf bytes.Buffer
+				w := NewEncoder(e.enc, &buf)
+
+				for p := data; len(p) != 0; {
+					n := rand.Intn(len(p) + 1)
+					if i%2 == 0 {
+						n = rand.Intn(8)
+					}
+
+					if n > len(p) {
+						n = len(p)
+					}
+
+					if _, err := w.Write(p[:n]); err != nil {
+						t.Fatal(err)
+					}
+
+					p = p[n:]
+				}
+
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+
+				if expect := e.ref.EncodeToString(data); buf.String() != expect {
+					t.Fatalf("NewEncoder wrote %q, expected %q", buf.String(), expect)
+				}
+			}
+		})
+	}
+}
+
+type limitedWriter struct {
+	n int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		w.n = 0
+		return 0, io.ErrShortWrite
+	}
+
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestEncoderError(t *testing.T) {
+	w := NewEncoder(StdEncoding, &limitedWriter{16})
+
+	if _, err := w.Write(make([]byte, 1024)); err != io.ErrShortWrite {
+		t.Fatalf("Write returned %v, expected %v", err, io.ErrShortWrite)
+	}
+
+	if _, err := w.Write(make([]byte, 3)); err != io.ErrShortWrite {
+		t.Fatalf("Write returned %v, expected %v", err, io.ErrShortWrite)
+	}
+
+	if err := w.Close(); err != io.ErrShortWrite {
+		t.Fatalf("Close returned %v, expected %v", err, io.ErrShortWrite)
+	}
+}
+
+func BenchmarkEncoder(b *testing.B) {
+	for _, size := range sizes[:6] {
+		b.Run(size.name, func(b *testing.B) {
+			src := make([]byte, size.l)
+			rand.Read(src)
+
+			b.SetBytes(int64(size.l))
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				w := NewEncoder(StdEncoding, ioutil.Discard)
+				w.Write(src)
+				w.Close()
+			}
+		})
+	}
+}
+
+func TestEncodingReader(t *testing.T) {
+	for _, e := range encodings {
+		t.Run(e.name, func(t *testing.T) {
+			for i := 0; i < 200; i++ {
+				data := make([]byte, rand.Intn(64*1024))
+				rand.Read(data)
+
+				enc := e.enc
+				if i%5 == 4 {
+					enc = enc.WithLineWrap(76, "\r\n")
+				}
+
+				var r io.Reader = bytes.NewReader(data)
+				switch i % 4 {
+				case 1:
+					r = iotest.HalfReader(r)
+				case 2:
+					r = iotest.OneByteReader(r)
+				case 3:
+					r = iotest.DataErrReader(r)
+				}
+
+				var out []byte
+				var err error
+				if i%2 == 0 {
+					out, err = readAll(NewEncodingReader(enc, r), rand.New(rand.NewSource(int64(i))))
+				} else {
+					var buf bytes.Buffer
+					_, err = io.Copy(&buf, NewEncodingReader(enc, r))
+					out = buf.Bytes()
+				}
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if expect := enc.EncodeToString(data); string(out) != expect {
+					t.Fatalf("NewEncodingReader read %q, expected %q", out, expect)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodingReaderError(t *testing.T) {
+	data := []byte("abcdefgh")
+
+	r := NewEncodingReader(StdEncoding, iotest.TimeoutReader(bytes.NewReader(data)))
+	if out, err := ioutil.ReadAll(r); err != iotest.ErrTimeout || string(out) != "YWJjZGVm" {
+		t.Fatalf("ReadAll returned %q, %v, expected %q, %v", out, err, "YWJjZGVm", iotest.ErrTimeout)
+	}
+
+	r = NewEncodingReader(StdEncoding, bytes.NewReader(data))
+	if _, err := io.Copy(&limitedWriter{4}, r); err != io.ErrShortWrite {
+		t.Fatalf("Copy returned %v, expected %v", err, io.ErrShortWrite)
+	}
+}
+
+func BenchmarkEncodingReader(b *testing.B) {
+	for _, size := range sizes[:6] {
+		b.Run(size.name, func(b *testing.B) {
+			src := make([]byte, size.l)
+			rand.Read(src)
+
+			b.SetBytes(int64(size.l))
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				io.Copy(ioutil.Discard, NewEncodingReader(StdEncoding, bytes.NewReader(src)))
+			}
+		})
+	}
+}
+
+// newlines inserts random '\r' and '\n' characters into s, returning the
+// new string.
+func newlines(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		for rand.Intn(8) == 0 {
+			buf.WriteByte("\r\n"[rand.Intn(2)])
+		}
+
+		buf.WriteByte(s[i])
+	}
+
+	return buf.String()
+}
+
+func readAll(r io.Reader, rnd *rand.Rand) ([]byte, error) {
+	var out []byte
+	buf := make([]byte, 32*1024)
+	for {
+		p := buf[:rnd.Intn(len(buf))]
+		if rnd.Intn(2) == 0 {
+			p = p[:rnd.Intn(8)]
+		}
+
+		n, err := r.Read(p)
+		out = append(out, p[:n]...)
+
+		if err == io.EOF {
+			return out, nil
+		} else if err != nil {
+			return out, err
+		}
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	for _, e := range encodings {
+		t.Run(e.name, func(t *testing.T) {
+			for i := 0; i < 200; i++ {
+				data := make([]byte, rand.Intn(16*1024))
+				rand.Read(data)
+
+				src := e.ref.EncodeToString(data)
+				if i%2 == 0 {
+					src = newlines(src)
+				}
+
+				var r io.Reader = strings.NewReader(src)
+				switch i % 3 {
+				case 1:
+					r = iotest.HalfReader(r)
+				case 2:
+					r = iotest.OneByteReader(r)
+				}
+
+				out, err := readAll(NewDecoder(e.enc, r), rand.New(rand.NewSource(int64(i))))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !bytes.Equal(out, data) {
+					t.Fatalf("NewDecoder read %x, expected %x", out, data)
+				}
+			}
+		})
+	}
+}
+
+func TestDecoderCorrupt(t *testing.T) {
+	for _, e := range encodings {
+		t.Run(e.name, func(t *testing.T) {
+			for i := 0; i < 500; i++ {
+				data := make([]byte, 1+rand.Intn(8*1024))
+				rand.Read(data)
+
+				src := []byte(newlines(e.ref.EncodeToString(data)))
+
+				off := rand.Intn(len(src))
+				for src[off] == '\r' || src[off] == '\n' || src[off] == '=' {
+					off = rand.Intn(len(src))
+				}
+
+				src[off] = '*'
+
+				var r io.Reader = bytes.NewReader(src)
+				if i%2 == 1 {
+					r = iotest.HalfReader(r)
+				}
+
+				_, err := readAll(NewDecoder(e.enc, r), rand.New(rand.NewSource(int64(i))))
+				if expect := (CorruptInputError{int64(off), '*', InvalidCharacter}); err != expect {
+					t.Fatalf("NewDecoder returned %v, expected %v", err, expect)
+				}
+			}
+		})
+	}
+}
+
+func TestDecoderUnexpectedEOF(t *testing.T) {
+	r := NewDecoder(StdEncoding, strings.NewReader("QUJDRA\n"))
+
+	if _, err := ioutil.ReadAll(r); err != io.ErrUnexpectedEOF {
+		t.Fatalf("ReadAll returned %v, expected %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestDecoderLongSkip(t *testing.T) {
+	// More skipped bytes than the decoder buffers at once between the
+	// characters of a quantum.
+	gap := strings.Repeat("\r\n", 16*1024)
+
+	out, err := ioutil.ReadAll(NewDecoder(StdEncoding, strings.NewReader("QU"+gap+"JD"+gap+"RA==")))
+	if err != nil || string(out) != "ABCD" {
+		t.Fatalf("ReadAll returned %q, %v, expected %q", out, err, "ABCD")
+	}
+
+	for _, test := range []struct {
+		src string
+		off int
+	}{
+		{"Q*" + gap + "JD", 1},
+		{"QU" + gap + "J*" + gap + "RA==", 2 + len(gap) + 1},
+		{"QUJD" + gap + "R" + gap + "*==", 4 + 2*len(gap) + 1},
+	} {
+		_, err := ioutil.ReadAll(NewDecoder(StdEncoding, iotest.HalfReader(strings.NewReader(test.src))))
+		if expect := (CorruptInputError{int64(test.off), '*', InvalidCharacter}); err != expect {
+			t.Errorf("ReadAll returned %v, expected %v", err, expect)
+		}
+	}
+}
+
+func benchmarkDecoder(b *testing.B, newDecoder func(r io.Reader) io.Reader) {
+	for _, wrap := range []int{0, 76} {
+		for _, size := range sizes[:6] {
+			name := size.name
+			if wrap != 0 {
+				name = "Wrapped/" + name
+			}
+
+			b.Run(name, func(b *testing.B) {
+				src := make([]byte, size.l)
+				rand.Read(src)
+
+				data := []byte(StdEncoding.WithLineWrap(wrap, "\r\n").EncodeToString(src))
+
+				b.SetBytes(int64(len(data)))
+				b.ResetTimer()
+
+				for i := 0; i < b.N; i++ {
+					io.Copy(ioutil.Discard, newDecoder(bytes.NewReader(data)))
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkDecoder(b *testing.B) {
+	benchmarkDecoder(b, func(r io.Reader) io.Reader {
+		return NewDecoder(StdEncoding, r)
+	})
+}
+
+func BenchmarkRefDecoder(b *testing.B) {
+	benchmarkDecoder(b, func(r io.Reader) io.Reader {
+		return ref.NewDecoder(ref.StdEncoding, r)
+	})
+}
@@ -0,0 +1,252 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package base64
+
+// WithLineWrap creates a new encoding identical to enc except that the
+// encoded output is split into lines of width characters separated by
+// sep, as MIME (RFC 2045) does with a width of 76 and a sep of "\r\n". No
+// separator is written after the last line. Decode expects input to be
+// wrapped in the same way, but also accepts a trailing separator. Unless
+// the encoding ignores no bytes (see WithIgnore), input that is wrapped
+// differently is still decoded, skipping the bytes of the separator
+// wherever they appear.
+//
+// The width must be a multiple of 4, or zero to disable line wrapping.
+// The separator must not be empty, or contain the padding character or
+// any character in the alphabet.
+func (enc Encoding) WithLineWrap(width int, sep string) Encoding {
+	switch {
+	case width < 0 || width%4 != 0:
+		panic("line width is not a multiple of 4")
+	case width == 0:
+		return enc.unwrapped()
+	case sep == "":
+		panic("empty line separator")
+	}
+
+	for i := 0; i < len(sep); i++ {
+		if enc.inAlphabet(sep[i]) || enc.isPadding(sep[i]) {
+			panic("line separator contained in alphabet")
+		}
+	}
+
+	enc.lineWidth, enc.lineSep = width, sep
+	return enc
+}
+
+// unwrapped returns enc without line wrapping.
+func (enc Encoding) unwrapped() Encoding {
+	enc.lineWidth, enc.lineSep = 0, ""
+	return enc
+}
+
+// encodeLines encodes src, which must not be empty, into dst as if col
+// characters of the current line had already been written. It returns the
+// number of bytes written and the new column. A separator is only written
+// before characters that do not fit on the current line.
+func (enc Encoding) encodeLines(dst, src []byte, col int) (n, ncol int) {
+	if enc.lineWidth == 0 {
+		enc.encodeTo(dst, src)
+		return enc.encodedLen(len(src)), 0
+	}
+
+	for len(src) != 0 {
+		if col == enc.lineWidth {
+			n += copy(dst[n:], enc.lineSep)
+			col = 0
+		}
+
+		// Lines hold a whole number of quanta, so only the
+		// final call to encodeTo may write padding.
+		m := (enc.lineWidth - col) / 4 * 3
+		if m > len(src) {
+			m = len(src)
+		}
+
+		enc.encodeTo(dst[n:], src[:m])
+
+		l := enc.encodedLen(m)
+		n += l
+		col += l
+		src = src[m:]
+	}
+
+	return n, col
+}
+
+// lastLine returns the number of complete lines in src before the last
+// line, and the offsets of the start and end of the last line, excluding
+// any trailing separator.
+func (enc Encoding) lastLine(src []byte) (lines, off, end int) {
+	end = len(src)
+	if hasSuffix(src, enc.lineSep) {
+		end -= len(enc.lineSep)
+	}
+
+	if end <= enc.lineWidth {
+		return 0, 0, end
+	}
+
+	line := enc.lineWidth + len(enc.lineSep)
+	lines = (end - enc.lineWidth + line - 1) / line
+
+	if off = lines * line; off > end {
+		// The final separator is incomplete.
+		off = end
+	}
+
+	return
+}
+
+// decodeLines decodes src, which should be wrapped as described by
+// WithLineWrap. Each complete line is decoded directly, and the last line
+// is decoded by decodeQuanta. If enc ignores any bytes, the input from the
+// first line that is not wrapped as expected is also decoded by
+// decodeQuanta, which then skips the separator.
+func (enc Encoding) decodeLines(dst, src []byte) (n int, err error) {
+	lines, last, end := enc.lastLine(src)
+	rest := enc.skipping()
+
+	for i, off := 0, 0; i < lines; i, off = i+1, off+enc.lineWidth+len(enc.lineSep) {
+		nn, ok := enc.decode(dst[n:], src[off:off+enc.lineWidth])
+		sep := off + enc.lineWidth
+		if ok && hasPrefix(src[sep:], enc.lineSep) {
+			n += nn
+			continue
+		}
+
+		switch {
+		case rest.ignore != "":
+			last, end = off, len(src)
+		case !ok:
+			// Padding is only valid on the last line.
+			return n + nn/4*3, enc.corruptInputError(src, off+nn)
+		default:
+			return n + nn, enc.separatorError(src, sep)
+		}
+
+		break
+	}
+
+	// Decode has checked dst against decodedLen, which does not count
+	// the separators that rest skips if they are where they are
+	// expected, so rest must not check it again.
+	nn, err := rest.decodeQuanta(dst[n:], src[last:end])
+	if e, ok := err.(CorruptInputError); ok {
+		e.Offset += int64(last)
+		if e.Reason == Truncated {
+			// Truncation is found at the end of the input, which
+			// is after any trailing separator, as it is for an
+			// encoding that does not wrap lines.
+			e.Offset += int64(len(src) - end)
+			if e.Offset < int64(len(src)) {
+				e.Char = src[e.Offset]
+			}
+		}
+
+		err = e
+	}
+
+	return n + nn, err
+}
+
+// separated reports whether each of the first lines lines of src is
+// followed by the separator, as decodeLines expects.
+func (enc Encoding) separated(src []byte, lines int) bool {
+	for i, off := 0, enc.lineWidth; i < lines; i, off = i+1, off+enc.lineWidth+len(enc.lineSep) {
+		if !hasPrefix(src[off:], enc.lineSep) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validLines reports whether src is valid in the same way that
+// decodeLines decodes it.
+func (enc Encoding) validLines(src []byte) bool {
+	lines, last, end := enc.lastLine(src)
+
+	for i, off := 0, 0; i < lines; i, off = i+1, off+enc.lineWidth+len(enc.lineSep) {
+		_, ok := enc.valid(src[off : off+enc.lineWidth])
+		if ok && hasPrefix(src[off+enc.lineWidth:], enc.lineSep) {
+			continue
+		}
+
+		if enc.ignore == "" {
+			return false
+		}
+
+		last, end = off, len(src)
+		break
+	}
+
+	return enc.skipping().Valid(src[last:end])
+}
+
+// validPrefixLines is ValidPrefix for an encoding that wraps lines and
+// ignores no bytes, so that every line before the last must be wrapped
+// exactly.
+func (enc Encoding) validPrefixLines(src []byte) int {
+	line := enc.lineWidth + len(enc.lineSep)
+
+	off := 0
+	for ; off+line <= len(src); off += line {
+		_, ok := enc.valid(src[off : off+enc.lineWidth])
+		if !ok || !hasPrefix(src[off+enc.lineWidth:], enc.lineSep) {
+			break
+		}
+	}
+
+	// The last line of the prefix begins at off, and may be followed by
+	// a separator.
+	end := off + enc.lineWidth
+	if end > len(src) {
+		end = len(src)
+	}
+
+	n := off + enc.unwrapped().ValidPrefix(src[off:end])
+	if hasPrefix(src[n:], enc.lineSep) {
+		n += len(enc.lineSep)
+	}
+
+	return n
+}
+
+// skipping returns enc without line wrapping which, if enc ignores any
+// bytes, also ignores the bytes of the separator.
+func (enc Encoding) skipping() Encoding {
+	if enc.ignore != "" {
+		enc.ignore += enc.lineSep
+	}
+
+	return enc.unwrapped()
+}
+
+// separatorError returns the error for src[off:] which does not begin
+// with the line separator.
+func (enc Encoding) separatorError(src []byte, off int) error {
+	for i := 0; off+i < len(src); i++ {
+		if c := src[off+i]; c != enc.lineSep[i] {
+			e := CorruptInputError{int64(off + i), c, InvalidCharacter}
+			if enc.isPadding(c) {
+				e.Reason = InvalidPadding
+			}
+
+			return e
+		}
+	}
+
+	return enc.corruptInputError(src, len(src))
+}
+
+func hasPrefix(b []byte, s string) bool {
+	return len(b) >= len(s) && string(b[:len(s)]) == s
+}
+
+func hasSuffix(b []byte, s string) bool {
+	return len(b) >= len(s) && string(b[len(b)-len(s):]) == s
+}
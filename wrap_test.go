@@ -0,0 +1,268 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package base64
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// wrap splits s into lines of width characters separated by sep.
+func wrap(s string, width int, sep string) string {
+	var buf bytes.Buffer
+	for len(s) > width {
+		buf.WriteString(s[:width])
+		buf.WriteString(sep)
+		s = s[width:]
+	}
+
+	buf.WriteString(s)
+	return buf.String()
+}
+
+var lineWraps = []struct {
+	width int
+	sep   string
+}{
+	{4, "\n"},
+	{8, "\r\n"},
+	{64, "\n"},
+	{76, "\r\n"},
+	{76, " | "},
+}
+
+func TestLineWrap(t *testing.T) {
+	for _, e := range encodings {
+		for _, w := range lineWraps {
+			enc := e.enc.WithLineWrap(w.width, w.sep)
+
+			t.Run(e.name+"/"+strconv.Itoa(w.width)+"/"+strconv.Quote(w.sep), func(t *testing.T) {
+				for l := 0; l < 300; l++ {
+					data := make([]byte, l)
+					rand.Read(data)
+
+					expect := wrap(e.ref.EncodeToString(data), w.width, w.sep)
+
+					if n := enc.EncodedLen(l); n != len(expect) {
+						t.Fatalf("EncodedLen(%d) = %d, expected %d", l, n, len(expect))
+					}
+
+					if got := enc.EncodeToString(data); got != expect {
+						t.Fatalf("EncodeToString(%x) = %q, expected %q", data, got, expect)
+					}
+
+					for _, src := range []string{expect, expect + w.sep} {
+						dst := make([]byte, l)
+
+						n, err := enc.Decode(dst, []byte(src))
+						if err != nil {
+							t.Fatalf("Decode(%q) returned %v", src, err)
+						}
+
+						if !bytes.Equal(dst[:n], data) {
+							t.Fatalf("Decode(%q) = %x, expected %x", src, dst[:n], data)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestLineWrapStream(t *testing.T) {
+	enc := StdEncoding.WithLineWrap(76, "\r\n")
+
+	data := make([]byte, 64*1024)
+	rand.Read(data)
+
+	var buf bytes.Buffer
+	w := NewEncoder(enc, &buf)
+
+	for p := data; len(p) > 0; {
+		n := rand.Intn(len(p) + 1)
+		if _, err := w.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+
+		p = p[n:]
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := enc.EncodeToString(data); buf.String() != expect {
+		t.Fatal("NewEncoder did not match EncodeToString")
+	}
+
+	got, err := ioutil.ReadAll(NewDecoder(enc, &buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, data) {
+		t.Fatal("NewDecoder did not decode NewEncoder output")
+	}
+}
+
+func TestLineWrapInvalid(t *testing.T) {
+	enc := StdEncoding.WithIgnore("").WithLineWrap(8, "\r\n")
+
+	for _, test := range []struct {
+		src    string
+		expect CorruptInputError
+	}{
+		{"QUJDREVGQ\r\nUJD", CorruptInputError{8, 'Q', InvalidCharacter}},
+		{"QUJD\r\nREVG", CorruptInputError{4, '\r', InvalidCharacter}},
+		{"QUJDREVG\nQUJD", CorruptInputError{8, '\n', InvalidCharacter}},
+		{"QUJDREVG\r", CorruptInputError{9, 0, Truncated}},
+		{"QUJDRA==\r\nQUJD", CorruptInputError{6, '=', InvalidPadding}},
+		{"QUJDREVG\r\nQU*D", CorruptInputError{12, '*', InvalidCharacter}},
+		{"QUJDREVG\r\nQUJD\r\n\r\n", CorruptInputError{14, '\r', InvalidCharacter}},
+	} {
+		dst := make([]byte, enc.DecodedLen(len(test.src)))
+		if _, err := enc.Decode(dst, []byte(test.src)); err != test.expect {
+			t.Errorf("Decode(%q) returned %#v, expected %#v", test.src, err, test.expect)
+		}
+	}
+}
+
+func TestLineWrapIgnore(t *testing.T) {
+	enc := StdEncoding.WithLineWrap(8, "\r\n")
+
+	for _, test := range []struct {
+		src    string
+		expect string
+		err    error
+	}{
+		{"QUJDREVGQ\r\nUJD", "ABCDEFABC", nil},
+		{"QUJD\r\nREVG", "ABCDEF", nil},
+		{"QUJDREVG\nQUJD", "ABCDEFABC", nil},
+		{"QUJDREVG\r", "ABCDEF", nil},
+		{"QUJDREVG\r\nQUJD\r\n\r\n", "ABCDEFABC", nil},
+		{"QUJDREVG\r\nQU\r\nJD\r\nREVG", "ABCDEFABCDEF", nil},
+		{"QUJDRA==\r\nQUJD", "ABCD", CorruptInputError{10, 'Q', InvalidPadding}},
+		{"QUJDREVG\r\nQU*D", "ABCDEF", CorruptInputError{12, '*', InvalidCharacter}},
+		{"QUJD\r\nREVG\r\nQU*D", "ABCDEF", CorruptInputError{14, '*', InvalidCharacter}},
+		{"QUJDREVGR0hJ\r\n", "ABCDEFGHI", nil},
+		{"QUJDREVG\r\nR0\nhJ", "ABCDEFGHI", nil},
+		{"QUJ\nDREV\r\nGR0h\r\nJ", "ABCDEFGHI", nil},
+	} {
+		dst := make([]byte, enc.DecodedLen(len(test.src)))
+		n, err := enc.Decode(dst, []byte(test.src))
+		if string(dst[:n]) != test.expect || err != test.err {
+			t.Errorf("Decode(%q) returned %q, %#v, expected %q, %#v", test.src, dst[:n], err, test.expect, test.err)
+		}
+
+		// DecodeString only allocates DecodedLenExact bytes.
+		got, err := enc.DecodeString(test.src)
+		if string(got) != test.expect || err != test.err {
+			t.Errorf("DecodeString(%q) returned %q, %#v, expected %q, %#v", test.src, got, err, test.expect, test.err)
+		}
+	}
+}
+
+// TestLineWrapTruncated checks that truncated input is reported at the
+// same offset whether or not the encoding wraps lines.
+func TestLineWrapTruncated(t *testing.T) {
+	for _, src := range []string{
+		"Tw\r\n",
+		"QUJDRA\r\n",
+		"QQ=\r\n",
+		"QUJDREVG\r\nQUJ\r\n",
+		"QUJDREVG\r\nQUJDRA\r\n",
+		"QUJDREVG\r\nQUJ",
+		"QUJDREVG\r\nQUJDREVG\r\nQ\r\n",
+	} {
+		_, expect := StdEncoding.DecodeString(src)
+		if e, ok := expect.(CorruptInputError); !ok || e.Reason != Truncated {
+			t.Fatalf("DecodeString(%q) returned %#v, expected a truncated input error", src, expect)
+		}
+
+		for _, enc := range []Encoding{
+			StdEncoding.WithLineWrap(8, "\r\n"),
+			StdEncoding.WithIgnore("").WithLineWrap(8, "\r\n"),
+		} {
+			if _, err := enc.DecodeString(src); err != expect {
+				t.Errorf("DecodeString(%q) returned %#v, expected %#v", src, err, expect)
+			}
+		}
+	}
+}
+
+// TestLineWrapIgnoreExact checks that Decode never needs more than
+// DecodedLenExact bytes of dst, or writes past them, for input that is
+// wrapped differently from the encoding.
+func TestLineWrapIgnoreExact(t *testing.T) {
+	for _, e := range encodings {
+		enc := e.enc.WithLineWrap(8, "\r\n")
+
+		for i := 0; i < 10000; i++ {
+			data := make([]byte, rand.Intn(64))
+			rand.Read(data)
+
+			src := []byte(enc.EncodeToString(data))
+			for j := rand.Intn(4); j > 0; j-- {
+				k := rand.Intn(len(src) + 1)
+
+				switch c := "\r\n=*"[rand.Intn(4)]; {
+				case c != '*' && k < len(src) && rand.Intn(2) == 0:
+					src = append(src[:k], src[k+1:]...)
+				default:
+					src = append(src[:k], append([]byte{c}, src[k:]...)...)
+				}
+			}
+
+			expect := make([]byte, len(src))
+			en, eerr := enc.Decode(expect, src)
+
+			l := enc.DecodedLenExact(src)
+			buf := make([]byte, l+32)
+			canary(buf)
+
+			n, err := enc.Decode(buf[:l], src)
+			if n != en || err != eerr || !bytes.Equal(buf[:n], expect[:en]) {
+				t.Fatalf("%s: Decode(%q) = %d, %v (%x), expected %d, %v (%x)", e.name, src, n, err, buf[:n], en, eerr, expect[:en])
+			}
+
+			checkCanary(t, buf[l:], "%s: Decode(%q)", e.name, src)
+		}
+	}
+}
+
+func TestLineWrapPanics(t *testing.T) {
+	for _, test := range []struct {
+		width int
+		sep   string
+	}{
+		{-4, "\n"},
+		{6, "\n"},
+		{4, ""},
+		{4, "\nA"},
+		{4, "="},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("WithLineWrap(%d, %q) did not panic", test.width, test.sep)
+				}
+			}()
+
+			StdEncoding.WithLineWrap(test.width, test.sep)
+		}()
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("WithPadding did not panic with padding in the line separator")
+		}
+	}()
+
+	StdEncoding.WithLineWrap(4, "\n.").WithPadding('.')
+}